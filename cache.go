@@ -0,0 +1,160 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultPreflightCacheTTL is the default amount of time that preflight decisions will be
+// cached for.
+const DefaultPreflightCacheTTL = time.Minute
+
+// PreflightCacheStats contains the counters for the preflight cache.
+type PreflightCacheStats struct {
+	// Hits is the number of preflights that were answered from the cache.
+	Hits uint64
+	// Misses is the number of preflights that had to be evaluated.
+	Misses uint64
+	// Entries is the number of decisions that are currently cached.
+	Entries int
+}
+
+// preflightKey is the normalized key for a cached preflight decision. The values are taken
+// directly from the request headers so building a key doesn't allocate.
+type preflightKey struct {
+	origin         string
+	method         string
+	headers        string
+	privateNetwork bool
+}
+
+// preflightCache is a bounded LRU cache (with expiry) of preflight decisions.
+type preflightCache struct {
+	// hits and misses are first so that they are 64-bit aligned for atomic access
+	hits    uint64
+	misses  uint64
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[preflightKey]*list.Element
+	order   *list.List
+}
+
+// preflightCacheEntry is a single cached decision.
+type preflightCacheEntry struct {
+	key     preflightKey
+	result  preflightResult
+	expires time.Time
+}
+
+// newPreflightCache creates a new preflightCache. If ttl is zero, DefaultPreflightCacheTTL
+// will be used.
+func newPreflightCache(size int, ttl time.Duration) *preflightCache {
+	if ttl <= 0 {
+		ttl = DefaultPreflightCacheTTL
+	}
+	return &preflightCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[preflightKey]*list.Element, size),
+		order:   list.New(),
+	}
+}
+
+// newPreflightKey builds the cache key for the request. If the request can't be cached
+// (e.g. it has multiple request header lines) false will be returned.
+func newPreflightKey(r *http.Request) (preflightKey, bool) {
+	if len(r.Header[HeaderKeyReqOrigin]) != 1 || len(r.Header[HeaderKeyAccCtlReqHeaders]) > 1 {
+		return preflightKey{}, false
+	}
+	return preflightKey{
+		origin:         r.Header[HeaderKeyReqOrigin][0],
+		method:         firstValue(r.Header[HeaderKeyAccCtlReqMethod]),
+		headers:        firstValue(r.Header[HeaderKeyAccCtlReqHeaders]),
+		privateNetwork: firstValue(r.Header[HeaderKeyAccCtlReqPrivateNetwork]) == "true",
+	}, true
+}
+
+// get returns the cached decision for the key (if there is an unexpired one).
+func (pc *preflightCache) get(key preflightKey) (preflightResult, bool) {
+	pc.mu.Lock()
+	element, ok := pc.entries[key]
+	if ok {
+		entry := element.Value.(*preflightCacheEntry)
+		if time.Now().Before(entry.expires) {
+			pc.order.MoveToFront(element)
+			result := entry.result
+			pc.mu.Unlock()
+			atomic.AddUint64(&pc.hits, 1)
+			if result.err != nil {
+				// the cached error must not be shared with the handler
+				result.err = result.err.Clone()
+			}
+			return result, true
+		}
+		pc.order.Remove(element)
+		delete(pc.entries, key)
+	}
+	pc.mu.Unlock()
+	atomic.AddUint64(&pc.misses, 1)
+	return preflightResult{}, false
+}
+
+// add caches the decision. The result header values (and error) are copied so that the cache
+// doesn't hold on to (or share) the request header values or the error given to the handler.
+func (pc *preflightCache) add(key preflightKey, result preflightResult) {
+	if result.err != nil {
+		result.err = result.err.Clone()
+	}
+	if result.allowOrigin != nil && &result.allowOrigin[0] != &headerValueAll[0] {
+		result.allowOrigin = []string{result.allowOrigin[0]}
+	}
+	if result.allowHeaders != nil {
+		result.allowHeaders = append([]string(nil), result.allowHeaders...)
+		result.allowHeaders = result.allowHeaders[:len(result.allowHeaders):len(result.allowHeaders)]
+	}
+	entry := &preflightCacheEntry{key: key, result: result, expires: time.Now().Add(pc.ttl)}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if element, ok := pc.entries[key]; ok {
+		element.Value = entry
+		pc.order.MoveToFront(element)
+		return
+	}
+	pc.entries[key] = pc.order.PushFront(entry)
+	for pc.order.Len() > pc.size {
+		oldest := pc.order.Back()
+		pc.order.Remove(oldest)
+		delete(pc.entries, oldest.Value.(*preflightCacheEntry).key)
+	}
+}
+
+// stats returns the current counters.
+func (pc *preflightCache) stats() PreflightCacheStats {
+	pc.mu.Lock()
+	entries := pc.order.Len()
+	pc.mu.Unlock()
+	return PreflightCacheStats{
+		Hits:    atomic.LoadUint64(&pc.hits),
+		Misses:  atomic.LoadUint64(&pc.misses),
+		Entries: entries,
+	}
+}
+
+// PreflightCacheStats returns the hit / miss counters for the preflight cache. If the cache
+// has not been enabled (see Options.PreflightCacheSize) the counters will always be zero.
+func (c *CORS) PreflightCacheStats() PreflightCacheStats {
+	if c.preflightCache == nil {
+		return PreflightCacheStats{}
+	}
+	return c.preflightCache.stats()
+}
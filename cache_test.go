@@ -0,0 +1,161 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"context"
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPreflightCache(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins:     []cors.OriginMatcher{cors.WC("https://*.theyakka.com")},
+		AllowedHeaders:     cors.DefaultHeadersWith("Authorization"),
+		MaxAge:             600,
+		PreflightCacheSize: 2,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	preflight := func(origin string) (http.Header, *cors.ValidationError) {
+		var validationError *cors.ValidationError
+		w := httptest.NewRecorder()
+		c.ValidatePreflight(w, buildPreflightRequest(origin), func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+			validationError = error
+		})
+		return w.Header(), validationError
+	}
+
+	for i := 0; i < 3; i++ {
+		header, err := preflight("https://app.theyakka.com")
+		if err != nil {
+			t.Error(err)
+		}
+		if header.Get(cors.HeaderKeyAccCtlResAllowOrigin) != "https://app.theyakka.com" ||
+			header.Get(cors.HeaderKeyAccResCtlMaxAge) != "600" ||
+			header.Get(cors.HeaderKeyAccCtlResAllowHeaders) != "Authorization, Content-Type" {
+			t.Error("expected the cached response headers to be applied")
+		}
+	}
+	if _, err := preflight("https://acme.com"); err == nil || err.Code != cors.PreflightErrOriginNotAllowed {
+		t.Error("expected the origin to not be allowed")
+	}
+	if _, err := preflight("https://acme.com"); err == nil || err.Code != cors.PreflightErrOriginNotAllowed {
+		t.Error("expected the cached rejection to be returned")
+	}
+	stats := c.PreflightCacheStats()
+	if stats.Hits != 3 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("unexpected cache stats: %+v", stats)
+	}
+
+	// adding a third entry should evict the least recently used one (app.theyakka.com)
+	_, _ = preflight("https://web.theyakka.com")
+	_, _ = preflight("https://app.theyakka.com")
+	stats = c.PreflightCacheStats()
+	if stats.Misses != 4 || stats.Entries != 2 {
+		t.Errorf("expected the least recently used entry to be evicted: %+v", stats)
+	}
+}
+
+func TestPreflightCacheTTL(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedHeaders:     cors.DefaultHeadersWith("Authorization"),
+		PreflightCacheSize: 10,
+		PreflightCacheTTL:  10 * time.Millisecond,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"), handler)
+	time.Sleep(20 * time.Millisecond)
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"), handler)
+	if stats := c.PreflightCacheStats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Errorf("expected the cached decision to have expired: %+v", stats)
+	}
+}
+
+func TestPreflightCacheDynamicRules(t *testing.T) {
+	calls := 0
+	allowed := func(origin cors.Origin) bool {
+		calls++
+		return origin.Host == "theyakka.com"
+	}
+	tests := []struct {
+		name     string
+		options  *cors.Options
+		expected int
+	}{
+		{"func matcher", &cors.Options{
+			AllowedOrigins: []cors.OriginMatcher{cors.MatchFunc("dynamic", allowed)},
+		}, 3},
+		{"cacheable func matcher", &cors.Options{
+			AllowedOrigins: []cors.OriginMatcher{&cors.FuncMatcher{Name: "static", Func: allowed, Cacheable: true}},
+		}, 1},
+		{"allow origin func", &cors.Options{
+			AllowOriginFunc: func(ctx context.Context, r *http.Request, origin string) (bool, error) {
+				calls++
+				return true, nil
+			},
+		}, 3},
+		{"cacheable allow origin func", &cors.Options{
+			AllowOriginFunc: func(ctx context.Context, r *http.Request, origin string) (bool, error) {
+				calls++
+				return true, nil
+			},
+			PreflightCacheAllowOriginFunc: true,
+		}, 1},
+	}
+	for _, test := range tests {
+		calls = 0
+		test.options.AllowedHeaders = cors.DefaultHeadersWith("Authorization")
+		test.options.PreflightCacheSize = 10
+		c, err := test.options.NewCORS()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for i := 0; i < 3; i++ {
+			c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"),
+				func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+					if error != nil {
+						t.Error(error)
+					}
+				})
+		}
+		if calls != test.expected {
+			t.Errorf("%s: expected %d calls but got %d", test.name, test.expected, calls)
+		}
+	}
+}
+
+func TestPreflightCacheAllocations(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins:     []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		AllowedHeaders:     cors.DefaultHeadersWith("Authorization"),
+		PreflightCacheSize: 10,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	req := buildPreflightRequest("https://theyakka.com")
+	w := httptest.NewRecorder()
+	allocs := testing.AllocsPerRun(100, func() {
+		c.ValidatePreflight(w, req, handler)
+	})
+	if allocs != 0 {
+		t.Errorf("expected 0 allocations but got %v", allocs)
+	}
+}
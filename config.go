@@ -0,0 +1,517 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix used for all of the environment variables read by
+// LoadOptionsEnv. For example, the allowed_origins key maps to CORS_ALLOWED_ORIGINS.
+const EnvPrefix = "CORS_"
+
+// Config is the serializable form of Options. It defines the schema used by the JSON,
+// YAML, TOML and environment variable loaders. The keys are:
+//
+//	allowed_origins           list of origins (see below)
+//	allowed_methods           list of http methods
+//	allowed_headers           list of header names
+//	exposed_headers           list of header names
+//	max_age                   integer (seconds)
+//	allow_credentials         boolean
+//	reflect_origin            boolean
+//	allow_private_network     boolean
+//	private_network_origins   list of origins (see below)
+//	preflight_success_status  integer (http status code)
+//	preflight_failure_status  integer (http status code)
+//
+// Origins are encoded as strings that are prefixed with the match type. For example,
+// "exact:https://theyakka.com", "glob:https://*.theyakka.com" or
+// "regex:https?://theyakka\.com". Values without a prefix are treated as exact matches.
+//
+// Only *Match origins can be represented in a Config. Other OriginMatcher types, the
+// AllowOriginFunc, the OriginStore and UnsafeReflectAnyOrigin need to be set in code.
+type Config struct {
+	AllowedOrigins         []*Match `json:"allowed_origins,omitempty"`
+	AllowedMethods         []string `json:"allowed_methods,omitempty"`
+	AllowedHeaders         []string `json:"allowed_headers,omitempty"`
+	ExposedHeaders         []string `json:"exposed_headers,omitempty"`
+	MaxAge                 int      `json:"max_age,omitempty"`
+	AllowCredentials       bool     `json:"allow_credentials,omitempty"`
+	ReflectOrigin          bool     `json:"reflect_origin,omitempty"`
+	AllowPrivateNetwork    bool     `json:"allow_private_network,omitempty"`
+	PrivateNetworkOrigins  []*Match `json:"private_network_origins,omitempty"`
+	PreflightSuccessStatus int      `json:"preflight_success_status,omitempty"`
+	PreflightFailureStatus int      `json:"preflight_failure_status,omitempty"`
+}
+
+// errNullOriginRule is returned when a Config contains a nil (null) origin rule.
+var errNullOriginRule = errors.New("origin rules cannot be null")
+
+// ConfigError is returned when a configuration source cannot be decoded.
+type ConfigError struct {
+	// Line is the (1-based) line number the error occurred on. It will be 0 if the line
+	// is unknown or the source doesn't have lines (e.g. environment variables).
+	Line int
+	// Key is the configuration key (or environment variable) that caused the error, if
+	// known.
+	Key string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the builtin error interface for our custom ConfigError type
+func (ce *ConfigError) Error() string {
+	message := ce.Err.Error()
+	if ce.Key != "" {
+		message = ce.Key + ": " + message
+	}
+	if ce.Line > 0 {
+		message = "line " + strconv.Itoa(ce.Line) + ": " + message
+	}
+	return "cors config: " + message
+}
+
+// Unwrap returns the underlying error.
+func (ce *ConfigError) Unwrap() error {
+	return ce.Err
+}
+
+// NewConfig creates a Config from the Options. If any of the origins are not *Match
+// values, an error will be returned because they cannot be serialized.
+func NewConfig(o *Options) (*Config, error) {
+	allowedOrigins, err := configMatches(o.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+	privateNetworkOrigins, err := configMatches(o.PrivateNetworkOrigins)
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		AllowedOrigins:         allowedOrigins,
+		AllowedMethods:         o.AllowedMethods,
+		AllowedHeaders:         o.AllowedHeaders,
+		ExposedHeaders:         o.ExposedHeaders,
+		MaxAge:                 o.MaxAge,
+		AllowCredentials:       o.AllowCredentials,
+		ReflectOrigin:          o.ReflectOrigin,
+		AllowPrivateNetwork:    o.AllowPrivateNetwork,
+		PrivateNetworkOrigins:  privateNetworkOrigins,
+		PreflightSuccessStatus: o.PreflightSuccessStatus,
+		PreflightFailureStatus: o.PreflightFailureStatus,
+	}, nil
+}
+
+// configMatches converts the matchers into *Match values.
+func configMatches(matchers []OriginMatcher) ([]*Match, error) {
+	var matches []*Match
+	for _, matcher := range matchers {
+		match, ok := matcher.(*Match)
+		if !ok {
+			return nil, fmt.Errorf("cors config: the %s origin rule cannot be serialized", matcher)
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// Options creates a new, validated Options instance from the Config.
+func (cfg *Config) Options() (*Options, error) {
+	o := &Options{
+		AllowedMethods:         cfg.AllowedMethods,
+		AllowedHeaders:         cfg.AllowedHeaders,
+		ExposedHeaders:         cfg.ExposedHeaders,
+		MaxAge:                 cfg.MaxAge,
+		AllowCredentials:       cfg.AllowCredentials,
+		ReflectOrigin:          cfg.ReflectOrigin,
+		AllowPrivateNetwork:    cfg.AllowPrivateNetwork,
+		PreflightSuccessStatus: cfg.PreflightSuccessStatus,
+		PreflightFailureStatus: cfg.PreflightFailureStatus,
+	}
+	for _, match := range cfg.AllowedOrigins {
+		if match == nil {
+			return nil, &ConfigError{Key: "allowed_origins", Err: errNullOriginRule}
+		}
+		o.AllowedOrigins = append(o.AllowedOrigins, match)
+	}
+	for _, match := range cfg.PrivateNetworkOrigins {
+		if match == nil {
+			return nil, &ConfigError{Key: "private_network_origins", Err: errNullOriginRule}
+		}
+		o.PrivateNetworkOrigins = append(o.PrivateNetworkOrigins, match)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// LoadOptionsFile loads Options from a JSON (.json), YAML (.yaml / .yml) or TOML (.toml)
+// file. The format is determined by the file extension.
+func LoadOptionsFile(path string) (*Options, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return LoadOptionsJSON(bytes.NewReader(data))
+	case ".yaml", ".yml":
+		return LoadOptionsYAML(bytes.NewReader(data))
+	case ".toml":
+		return LoadOptionsTOML(bytes.NewReader(data))
+	}
+	return nil, &ConfigError{Err: errors.New("unsupported config file type " + strconv.Quote(path))}
+}
+
+// LoadOptionsJSON decodes a JSON Config and converts it into validated Options.
+func LoadOptionsJSON(r io.Reader) (*Options, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	cfg := &Config{}
+	if err := decoder.Decode(cfg); err != nil {
+		configErr := &ConfigError{Err: err}
+		switch jsonErr := err.(type) {
+		case *json.SyntaxError:
+			configErr.Line = lineForOffset(data, jsonErr.Offset)
+		case *json.UnmarshalTypeError:
+			configErr.Line = lineForOffset(data, jsonErr.Offset)
+			configErr.Key = jsonErr.Field
+		default:
+			// the error came from decoding an origin rule (which doesn't report a location)
+			if originErr := jsonOriginError(data); originErr != nil {
+				return nil, originErr
+			}
+		}
+		return nil, configErr
+	}
+	// decoder.More doesn't report a stray closing delimiter so check for any trailing content
+	if rest := data[decoder.InputOffset():]; len(bytes.TrimSpace(rest)) > 0 {
+		offset := int64(len(data) - len(bytes.TrimLeft(rest, " \t\r\n")))
+		return nil, &ConfigError{
+			Line: lineForOffset(data, offset),
+			Err:  errors.New("unexpected content after the config object"),
+		}
+	}
+	o, err := cfg.Options()
+	if err != nil {
+		if originErr := jsonOriginError(data); originErr != nil {
+			return nil, originErr
+		}
+		return nil, configValidationError(err, func(key string) (int, string) {
+			if offset := bytes.Index(data, []byte(strconv.Quote(key))); offset >= 0 {
+				return lineForOffset(data, int64(offset)), key
+			}
+			return 0, key
+		})
+	}
+	return o, nil
+}
+
+// LoadOptionsYAML decodes a YAML Config and converts it into validated Options. Only the
+// subset of YAML needed for the Config schema is supported: top-level keys with scalar
+// values, flow lists ([a, b]) and block lists (- a).
+func LoadOptionsYAML(r io.Reader) (*Options, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseYAMLConfig(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfigValues(values)
+}
+
+// LoadOptionsTOML decodes a TOML Config and converts it into validated Options. Only the
+// subset of TOML needed for the Config schema is supported: top-level keys with string,
+// integer, boolean or array values. Tables are not supported.
+func LoadOptionsTOML(r io.Reader) (*Options, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parseTOMLConfig(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfigValues(values)
+}
+
+// LoadOptionsEnv loads Options from the environment. Each Config key maps to an upper case
+// environment variable prefixed with EnvPrefix (e.g. CORS_ALLOWED_ORIGINS or CORS_MAX_AGE).
+// List values are comma separated.
+func LoadOptionsEnv() (*Options, error) {
+	return LoadOptionsEnvFunc(os.LookupEnv)
+}
+
+// LoadOptionsEnvFunc is the same as LoadOptionsEnv but uses the lookup function to read the
+// environment variables.
+func LoadOptionsEnvFunc(lookup func(key string) (string, bool)) (*Options, error) {
+	var values []configValue
+	for _, key := range configKeys {
+		envKey := EnvPrefix + strings.ToUpper(key)
+		if value, ok := lookup(envKey); ok {
+			values = append(values, configValue{key: key, name: envKey, scalar: value})
+		}
+	}
+	return decodeConfigValues(values)
+}
+
+// jsonOriginError finds the first origin rule in the JSON Config that is null or cannot be
+// decoded and returns a ConfigError (with the line and key) for it. If there is no such
+// rule, nil will be returned.
+func jsonOriginError(data []byte) *ConfigError {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil
+		}
+		key, _ := token.(string)
+		if key != "allowed_origins" && key != "private_network_origins" {
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return nil
+			}
+			continue
+		}
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil
+		}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil
+			}
+			line := lineForOffset(data, decoder.InputOffset())
+			value, ok := token.(string)
+			if token == nil {
+				return &ConfigError{Line: line, Key: key, Err: errNullOriginRule}
+			} else if !ok {
+				// type errors are reported by the decoder
+				return nil
+			}
+			if err := (&Match{}).UnmarshalText([]byte(value)); err != nil {
+				return &ConfigError{Line: line, Key: key, Err: err}
+			}
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// lineForOffset converts a byte offset into a (1-based) line number.
+func lineForOffset(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// configValue is a raw value read from a YAML, TOML or environment variable source.
+type configValue struct {
+	// line is the line the value was read from (0 if unknown).
+	line int
+	// key is the Config key.
+	key string
+	// name is the name used in errors. If empty, key will be used.
+	name string
+	// scalar is the value if it is not a list.
+	scalar string
+	// quoted is true if the scalar was quoted in the source.
+	quoted bool
+	// list contains the values if isList is true.
+	list   []string
+	isList bool
+	// lines contains the line number for each of the list values (if known).
+	lines []int
+}
+
+// configKeys contains all of the supported Config keys in the order they are documented.
+var configKeys = []string{
+	"allowed_origins", "allowed_methods", "allowed_headers", "exposed_headers", "max_age",
+	"allow_credentials", "reflect_origin", "allow_private_network", "private_network_origins",
+	"preflight_success_status", "preflight_failure_status",
+}
+
+// configSetters contains the functions that convert each of the raw values into the
+// appropriate Config field.
+var configSetters = map[string]func(cfg *Config, value configValue) error{
+	"allowed_origins": func(cfg *Config, value configValue) (err error) {
+		cfg.AllowedOrigins, err = value.matches()
+		return err
+	},
+	"allowed_methods": func(cfg *Config, value configValue) error {
+		cfg.AllowedMethods = value.strings()
+		return nil
+	},
+	"allowed_headers": func(cfg *Config, value configValue) error {
+		cfg.AllowedHeaders = value.strings()
+		return nil
+	},
+	"exposed_headers": func(cfg *Config, value configValue) error {
+		cfg.ExposedHeaders = value.strings()
+		return nil
+	},
+	"max_age": func(cfg *Config, value configValue) (err error) {
+		cfg.MaxAge, err = value.integer()
+		return err
+	},
+	"allow_credentials": func(cfg *Config, value configValue) (err error) {
+		cfg.AllowCredentials, err = value.boolean()
+		return err
+	},
+	"reflect_origin": func(cfg *Config, value configValue) (err error) {
+		cfg.ReflectOrigin, err = value.boolean()
+		return err
+	},
+	"allow_private_network": func(cfg *Config, value configValue) (err error) {
+		cfg.AllowPrivateNetwork, err = value.boolean()
+		return err
+	},
+	"private_network_origins": func(cfg *Config, value configValue) (err error) {
+		cfg.PrivateNetworkOrigins, err = value.matches()
+		return err
+	},
+	"preflight_success_status": func(cfg *Config, value configValue) (err error) {
+		cfg.PreflightSuccessStatus, err = value.integer()
+		return err
+	},
+	"preflight_failure_status": func(cfg *Config, value configValue) (err error) {
+		cfg.PreflightFailureStatus, err = value.integer()
+		return err
+	},
+}
+
+// decodeConfigValues converts the raw values into validated Options.
+func decodeConfigValues(values []configValue) (*Options, error) {
+	cfg := &Config{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		name := value.name
+		if name == "" {
+			name = value.key
+		}
+		setter, ok := configSetters[value.key]
+		if !ok {
+			return nil, &ConfigError{Line: value.line, Key: name, Err: errors.New("unknown key")}
+		}
+		if seen[value.key] {
+			return nil, &ConfigError{Line: value.line, Key: name, Err: errors.New("duplicate key")}
+		}
+		seen[value.key] = true
+		if err := setter(cfg, value); err != nil {
+			if configErr, ok := err.(*ConfigError); ok {
+				// the error already knows exactly where it came from
+				configErr.Key = name
+				return nil, configErr
+			}
+			return nil, &ConfigError{Line: value.line, Key: name, Err: err}
+		}
+	}
+	o, err := cfg.Options()
+	if err != nil {
+		return nil, configValidationError(err, func(key string) (int, string) {
+			for _, value := range values {
+				if value.key == key && value.name != "" {
+					return value.line, value.name
+				}
+				if value.key == key {
+					return value.line, key
+				}
+			}
+			return 0, key
+		})
+	}
+	return o, nil
+}
+
+// configValidationError converts a ValidationError returned when validating the Options
+// into a ConfigError for the key that caused it. The locate function returns the line and
+// name of the key in the source. Any other error is returned as is.
+func configValidationError(err error, locate func(key string) (int, string)) error {
+	validationErr, ok := err.(*ValidationError)
+	if !ok || validationErr.configKey == "" {
+		return err
+	}
+	line, name := locate(validationErr.configKey)
+	return &ConfigError{Line: line, Key: name, Err: err}
+}
+
+// strings returns the list values. If the value is a scalar it will be split on commas.
+func (cv configValue) strings() []string {
+	if cv.isList {
+		return cv.list
+	}
+	var values []string
+	for _, value := range strings.Split(cv.scalar, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// matches returns the list values decoded as *Match values.
+func (cv configValue) matches() ([]*Match, error) {
+	var matches []*Match
+	for i, value := range cv.strings() {
+		match := &Match{}
+		if err := match.UnmarshalText([]byte(value)); err != nil {
+			if i < len(cv.lines) {
+				return nil, &ConfigError{Line: cv.lines[i], Err: err}
+			}
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// integer returns the value as an int.
+func (cv configValue) integer() (int, error) {
+	if cv.isList || cv.quoted {
+		return 0, errors.New("expected an integer")
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(cv.scalar))
+	if err != nil {
+		return 0, errors.New("expected an integer")
+	}
+	return value, nil
+}
+
+// boolean returns the value as a bool.
+func (cv configValue) boolean() (bool, error) {
+	if cv.isList || cv.quoted {
+		return false, errors.New("expected a boolean")
+	}
+	value, err := strconv.ParseBool(strings.TrimSpace(cv.scalar))
+	if err != nil {
+		return false, errors.New("expected a boolean")
+	}
+	return value, nil
+}
@@ -0,0 +1,282 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parseYAMLConfig parses the subset of YAML needed for the Config schema. Every key must be
+// at the top level. Values can be scalars (plain, single or double quoted), flow lists
+// ([a, "b"]) or block lists where each item is an indented "- value" line.
+func parseYAMLConfig(source string) ([]configValue, error) {
+	var values []configValue
+	// listIndex is the index of the value that is waiting for block list items (or -1)
+	listIndex := -1
+	for i, raw := range strings.Split(source, "\n") {
+		lineNumber := i + 1
+		line, err := stripComment(strings.TrimRight(raw, " \t\r"))
+		if err != nil {
+			return nil, &ConfigError{Line: lineNumber, Err: err}
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if line[0] == '\t' {
+			return nil, &ConfigError{Line: lineNumber, Err: errors.New("tabs cannot be used for indentation")}
+		}
+
+		if line[0] == ' ' || strings.HasPrefix(line, "- ") || line == "-" {
+			// block list item
+			if listIndex < 0 || !(strings.HasPrefix(trimmed, "- ") || trimmed == "-") {
+				return nil, &ConfigError{Line: lineNumber, Err: errors.New("unexpected indentation")}
+			}
+			item, quoted, err := parseYAMLScalar(strings.TrimSpace(trimmed[1:]))
+			if err != nil {
+				return nil, &ConfigError{Line: lineNumber, Key: values[listIndex].key, Err: err}
+			}
+			if item == "" && !quoted {
+				return nil, &ConfigError{Line: lineNumber, Key: values[listIndex].key, Err: errors.New("empty list item")}
+			}
+			values[listIndex].list = append(values[listIndex].list, item)
+			values[listIndex].lines = append(values[listIndex].lines, lineNumber)
+			continue
+		}
+
+		listIndex = -1
+		colon := strings.IndexByte(trimmed, ':')
+		if colon <= 0 || (colon < len(trimmed)-1 && trimmed[colon+1] != ' ') {
+			return nil, &ConfigError{Line: lineNumber, Err: errors.New("expected a key: value pair")}
+		}
+		key := trimmed[:colon]
+		rest := strings.TrimSpace(trimmed[colon+1:])
+		value := configValue{line: lineNumber, key: key}
+		switch {
+		case rest == "":
+			// the value is a block list (which might be empty)
+			value.isList = true
+			listIndex = len(values)
+		case strings.HasPrefix(rest, "["):
+			if !strings.HasSuffix(rest, "]") {
+				return nil, &ConfigError{Line: lineNumber, Key: key, Err: errors.New("unterminated flow list")}
+			}
+			items, err := splitList(rest[1:len(rest)-1], parseYAMLScalar)
+			if err != nil {
+				return nil, &ConfigError{Line: lineNumber, Key: key, Err: err}
+			}
+			value.list, value.isList = items, true
+		default:
+			value.scalar, value.quoted, err = parseYAMLScalar(rest)
+			if err != nil {
+				return nil, &ConfigError{Line: lineNumber, Key: key, Err: err}
+			}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseYAMLScalar parses a plain, single quoted or double quoted YAML scalar.
+func parseYAMLScalar(value string) (string, bool, error) {
+	if len(value) == 0 {
+		return "", false, nil
+	}
+	switch value[0] {
+	case '"':
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return "", false, errors.New("invalid double quoted string")
+		}
+		return unquoted, true, nil
+	case '\'':
+		if len(value) < 2 || value[len(value)-1] != '\'' {
+			return "", false, errors.New("invalid single quoted string")
+		}
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), true, nil
+	case '[', '{', '&', '*', '!', '|', '>':
+		return "", false, errors.New("unsupported YAML syntax")
+	}
+	return value, false, nil
+}
+
+// parseTOMLConfig parses the subset of TOML needed for the Config schema. Every key must be
+// at the top level (tables are not supported). Values can be strings (basic or literal),
+// integers, booleans or arrays of strings. Arrays can span multiple lines.
+func parseTOMLConfig(source string) ([]configValue, error) {
+	var values []configValue
+	lines := strings.Split(source, "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNumber := i + 1
+		line, err := stripComment(lines[i])
+		if err != nil {
+			return nil, &ConfigError{Line: lineNumber, Err: err}
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			return nil, &ConfigError{Line: lineNumber, Err: errors.New("tables are not supported")}
+		}
+		equals := strings.IndexByte(trimmed, '=')
+		if equals <= 0 {
+			return nil, &ConfigError{Line: lineNumber, Err: errors.New("expected a key = value pair")}
+		}
+		key := strings.TrimSpace(trimmed[:equals])
+		rest := strings.TrimSpace(trimmed[equals+1:])
+		value := configValue{line: lineNumber, key: key}
+		if strings.HasPrefix(rest, "[") {
+			// keep consuming lines until the array has been closed. each line is split
+			// separately so that we know which line each of the items came from.
+			value.isList = true
+			fragment, fragmentLine := rest[1:], lineNumber
+			for {
+				closed := strings.HasSuffix(fragment, "]")
+				if closed {
+					fragment = fragment[:len(fragment)-1]
+				}
+				items, err := splitList(fragment, parseTOMLString)
+				if err != nil {
+					return nil, &ConfigError{Line: fragmentLine, Key: key, Err: err}
+				}
+				for _, item := range items {
+					value.list = append(value.list, item)
+					value.lines = append(value.lines, fragmentLine)
+				}
+				if closed {
+					break
+				}
+				i++
+				if i >= len(lines) {
+					return nil, &ConfigError{Line: lineNumber, Key: key, Err: errors.New("unterminated array")}
+				}
+				fragmentLine = i + 1
+				next, err := stripComment(lines[i])
+				if err != nil {
+					return nil, &ConfigError{Line: fragmentLine, Key: key, Err: err}
+				}
+				fragment = strings.TrimSpace(next)
+			}
+		} else if strings.HasPrefix(rest, "\"") || strings.HasPrefix(rest, "'") {
+			value.scalar, _, err = parseTOMLString(rest)
+			if err != nil {
+				return nil, &ConfigError{Line: lineNumber, Key: key, Err: err}
+			}
+			value.quoted = true
+		} else if rest == "" {
+			return nil, &ConfigError{Line: lineNumber, Key: key, Err: errors.New("missing value")}
+		} else {
+			// integers and booleans (underscores are allowed in integers)
+			value.scalar = strings.Replace(rest, "_", "", -1)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseTOMLString parses a basic ("...") or literal ('...') TOML string.
+func parseTOMLString(value string) (string, bool, error) {
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return value[1 : len(value)-1], true, nil
+	}
+	if len(value) >= 2 && value[0] == '"' {
+		unquoted, err := strconv.Unquote(value)
+		if err == nil {
+			return unquoted, true, nil
+		}
+	}
+	return "", false, errors.New("expected a string")
+}
+
+// splitList splits the contents of a flow list / array on commas (ignoring any commas that
+// are inside of quotes) and parses each item. A trailing comma is allowed.
+func splitList(contents string, parse func(string) (string, bool, error)) ([]string, error) {
+	var items []string
+	start := 0
+	var quote byte
+	for i := 0; i <= len(contents); i++ {
+		if i < len(contents) {
+			b := contents[i]
+			switch {
+			case quote != 0 && b == '\\' && quote == '"':
+				i++
+			case quote != 0 && b == quote:
+				quote = 0
+			case quote == 0 && (b == '"' || b == '\'') && strings.TrimSpace(contents[start:i]) == "":
+				// quotes only start a string at the beginning of an item
+				quote = b
+			}
+			if quote != 0 || b != ',' {
+				continue
+			}
+		} else if quote != 0 {
+			return nil, errors.New("unterminated string")
+		}
+		raw := strings.TrimSpace(contents[start:i])
+		start = i + 1
+		if raw == "" {
+			if i == len(contents) {
+				// trailing comma (or empty list)
+				break
+			}
+			return nil, errors.New("empty list item")
+		}
+		item, _, err := parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// stripComment removes any '#' comment from the line (ignoring any '#' that are inside of
+// quotes). An error will be returned if a quoted string isn't terminated.
+func stripComment(line string) (string, error) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		b := line[i]
+		switch {
+		case quote != 0 && b == '\\' && quote == '"':
+			i++
+		case quote != 0 && b == quote:
+			quote = 0
+		case quote == 0 && (b == '"' || b == '\'') && startsValue(line, i):
+			quote = b
+		case quote == 0 && b == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i], nil
+		}
+	}
+	if quote != 0 {
+		return "", errors.New("unterminated string")
+	}
+	return line, nil
+}
+
+// startsValue returns true if the character at index i is the first character of a value.
+// Quotes only start a string at the beginning of a value, so the apostrophe in a plain
+// value such as X-Don't is just a character.
+func startsValue(line string, i int) bool {
+	j := i - 1
+	for j >= 0 && (line[j] == ' ' || line[j] == '\t') {
+		j--
+	}
+	if j < 0 {
+		return true
+	}
+	switch line[j] {
+	case '[', ',', '=':
+		return true
+	case ':', '-':
+		// the separator must be followed by whitespace (e.g. "key: 'value'" or "- 'value'")
+		return j < i-1
+	}
+	return false
+}
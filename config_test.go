@@ -0,0 +1,213 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/theyakka/cors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const jsonConfig = `{
+  "allowed_origins": ["exact:https://theyakka.com", "glob:https://*.theyakka.com"],
+  "allowed_headers": ["Authorization", "Content-Type"],
+  "max_age": 600,
+  "allow_credentials": true
+}`
+
+const yamlConfig = `# cors settings
+allowed_origins:
+  - exact:https://theyakka.com
+  - "glob:https://*.theyakka.com" # subdomains
+allowed_headers: [Authorization, 'Content-Type']
+max_age: 600
+allow_credentials: true
+`
+
+const tomlConfig = `# cors settings
+allowed_origins = [
+  "exact:https://theyakka.com",
+  'glob:https://*.theyakka.com', # subdomains
+]
+allowed_headers = ["Authorization", "Content-Type"]
+max_age = 600
+allow_credentials = true
+`
+
+func TestLoadOptions(t *testing.T) {
+	loaders := map[string]func() (*cors.Options, error){
+		"json": func() (*cors.Options, error) { return cors.LoadOptionsJSON(strings.NewReader(jsonConfig)) },
+		"yaml": func() (*cors.Options, error) { return cors.LoadOptionsYAML(strings.NewReader(yamlConfig)) },
+		"toml": func() (*cors.Options, error) { return cors.LoadOptionsTOML(strings.NewReader(tomlConfig)) },
+		"env": func() (*cors.Options, error) {
+			env := map[string]string{
+				"CORS_ALLOWED_ORIGINS":   "exact:https://theyakka.com, glob:https://*.theyakka.com",
+				"CORS_ALLOWED_HEADERS":   "Authorization,Content-Type",
+				"CORS_MAX_AGE":           "600",
+				"CORS_ALLOW_CREDENTIALS": "true",
+			}
+			return cors.LoadOptionsEnvFunc(func(key string) (string, bool) {
+				value, ok := env[key]
+				return value, ok
+			})
+		},
+	}
+	for name, loader := range loaders {
+		o, err := loader()
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+		if len(o.AllowedOrigins) != 2 || o.AllowedOrigins[0].String() != "exact:https://theyakka.com" ||
+			o.AllowedOrigins[1].String() != "glob:https://*.theyakka.com" {
+			t.Errorf("%s: allowed origins don't match expected", name)
+		}
+		if !reflect.DeepEqual(o.AllowedHeaders, []string{"Authorization", "Content-Type"}) {
+			t.Errorf("%s: allowed headers don't match expected", name)
+		}
+		if o.MaxAge != 600 || !o.AllowCredentials {
+			t.Errorf("%s: max age / allow credentials don't match expected", name)
+		}
+	}
+}
+
+func TestLoadOptionsErrors(t *testing.T) {
+	expectations := []struct {
+		name   string
+		loader func(config string) (*cors.Options, error)
+		config string
+		line   int
+		key    string
+	}{
+		{"json syntax", jsonLoader, "{\n  \"max_age\": 600,\n  oops\n}", 3, ""},
+		{"json type", jsonLoader, "{\n  \"max_age\": \"600\"\n}", 2, "max_age"},
+		{"yaml type", yamlLoader, "allowed_headers: [Authorization]\nmax_age: soon\n", 2, "max_age"},
+		{"yaml unknown key", yamlLoader, "max_age: 600\nallowed_origin: https://theyakka.com\n", 2, "allowed_origin"},
+		{"yaml indentation", yamlLoader, "max_age: 600\n  - 700\n", 2, ""},
+		{"yaml regex", yamlLoader, "allowed_origins:\n  - exact:https://theyakka.com\n  - regex:https?://(theyakka\\.com\n", 3, "allowed_origins"},
+		{"toml type", tomlLoader, "max_age = 600\nallow_credentials = \"yes\"\n", 2, "allow_credentials"},
+		{"toml regex", tomlLoader, "allowed_origins = [\n  'exact:https://theyakka.com',\n  'regex:(',\n]\n", 3, "allowed_origins"},
+		{"toml table", tomlLoader, "max_age = 600\n[cors]\n", 2, ""},
+		{"toml unterminated", tomlLoader, "allowed_methods = [\n  \"GET\",\n", 1, "allowed_methods"},
+		{"yaml validation", yamlLoader, "allowed_origins: ['*']\nallow_credentials: true\n", 2, "allow_credentials"},
+		{"yaml invalid origin", yamlLoader, "max_age: 600\nallowed_origins: [https://theyakka.com/path]\n", 2, "allowed_origins"},
+		{"json validation", jsonLoader, "{\n  \"max_age\": 600,\n  \"reflect_origin\": true\n}", 3, "reflect_origin"},
+		{"toml validation", tomlLoader, "exposed_headers = ['*']\nallow_credentials = true\n", 2, "allow_credentials"},
+		{"json regex", jsonLoader, "{\n  \"allowed_origins\": [\n    \"exact:https://theyakka.com\",\n    \"regex:https://(\"\n  ]\n}", 4, "allowed_origins"},
+		{"json null origin", jsonLoader, "{\n  \"max_age\": 600,\n  \"private_network_origins\": [null]\n}", 3, "private_network_origins"},
+		{"json trailing content", jsonLoader, "{\"max_age\": 5}\n{\"bogus\": 1}", 2, ""},
+		{"json trailing delimiter", jsonLoader, "{\"max_age\": 5}}", 1, ""},
+	}
+	for _, expectation := range expectations {
+		_, err := expectation.loader(expectation.config)
+		var configErr *cors.ConfigError
+		if !errors.As(err, &configErr) {
+			t.Errorf("%s: expected a config error but got %v", expectation.name, err)
+			continue
+		}
+		if configErr.Line != expectation.line || configErr.Key != expectation.key {
+			t.Errorf("%s: expected error at line %d (%q) but got: %s", expectation.name, expectation.line,
+				expectation.key, configErr)
+		}
+	}
+}
+
+func TestLoadOptionsJSONNullOrigin(t *testing.T) {
+	_, err := cors.LoadOptionsJSON(strings.NewReader(`{"allowed_origins":[null]}`))
+	var configErr *cors.ConfigError
+	if !errors.As(err, &configErr) || configErr.Key != "allowed_origins" {
+		t.Errorf("expected the null origin rule to be rejected but got %v", err)
+	}
+	_, err = (&cors.Config{AllowedOrigins: []*cors.Match{nil}}).Options()
+	if !errors.As(err, &configErr) || configErr.Key != "allowed_origins" {
+		t.Errorf("expected the nil origin rule to be rejected but got %v", err)
+	}
+}
+
+func TestLoadOptionsJSONRegexError(t *testing.T) {
+	_, err := cors.LoadOptionsJSON(strings.NewReader(`{"allowed_origins":["regex:https://("]}`))
+	if err == nil || strings.Contains(err.Error(), "^(?:") {
+		t.Errorf("expected the error to only include the configured expression but got %v", err)
+	}
+}
+
+func TestLoadOptionsYAMLApostrophes(t *testing.T) {
+	o, err := cors.LoadOptionsYAML(strings.NewReader("allowed_headers:\n  - X-Don't # comment\nexposed_headers: [X-Can't, 'X-Quoted']\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !reflect.DeepEqual(o.AllowedHeaders, []string{"X-Don't"}) ||
+		!reflect.DeepEqual(o.ExposedHeaders, []string{"X-Can't", "X-Quoted"}) {
+		t.Errorf("unexpected headers: %v / %v", o.AllowedHeaders, o.ExposedHeaders)
+	}
+}
+
+func TestLoadOptionsValidates(t *testing.T) {
+	_, err := cors.LoadOptionsYAML(strings.NewReader("allowed_origins: ['*']\nallow_credentials: true\n"))
+	var validationErr *cors.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != cors.ConfigurationInvalid {
+		t.Error("expected the loaded options to have been validated")
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	o := &cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.EM("https://theyakka.com"), cors.WC("https://*.theyakka.com"), cors.RX(`https?://localhost:8[0-9]{3}`),
+		},
+		MaxAge: 600,
+	}
+	cfg, err := cors.NewConfig(o)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	loaded, err := cors.LoadOptionsJSON(strings.NewReader(string(data)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, matcher := range loaded.AllowedOrigins {
+		if matcher.String() != o.AllowedOrigins[i].String() {
+			t.Errorf("expected %s but got %s", o.AllowedOrigins[i], matcher)
+		}
+	}
+	c, err := loaded.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !c.IsOriginAllowed("http://localhost:8022") {
+		t.Error("expected the regex origin to have survived the round trip")
+	}
+
+	o.AllowedOrigins = append(o.AllowedOrigins, cors.DomainSuffix("theyakka.com"))
+	if _, err := cors.NewConfig(o); err == nil {
+		t.Error("expected a non-serializable matcher to be rejected")
+	}
+}
+
+func jsonLoader(config string) (*cors.Options, error) {
+	return cors.LoadOptionsJSON(strings.NewReader(config))
+}
+
+func yamlLoader(config string) (*cors.Options, error) {
+	return cors.LoadOptionsYAML(strings.NewReader(config))
+}
+
+func tomlLoader(config string) (*cors.Options, error) {
+	return cors.LoadOptionsTOML(strings.NewReader(config))
+}
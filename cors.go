@@ -10,15 +10,27 @@ package cors
 // library. You will use an instance of this type for all interactions. Instances can be
 // created directly or they can be created via Options.NewCORS.
 type CORS struct {
+	// rejectedLogCount is the number of rejections that could have been logged. It is used
+	// for sampling. It is first so that it is 64-bit aligned for atomic access.
+	rejectedLogCount uint64
 	// options is the attached set of options used to create this instance.
 	options *Options
-	// allowedOrigins is the cleaned list of origins we will allow. If allowedOrigins is
-	// empty, then it will be assumed all origins will be allowed (areAllOriginsAllowed will
-	// be true).
-	allowedOrigins []*Match
+	// allowedOrigins is the compiled index of the origins we will allow. If allowedOrigins
+	// is nil, then either all origins will be allowed (areAllOriginsAllowed will be true) or
+	// the AllowOriginFunc / OriginStore will decide.
+	allowedOrigins *originIndex
 	// areAllOriginsAllowed will be true if the AllowedOrigins value in the attached Options
 	// instance contained the '*' origin or if AllowedOrigins was empty.
 	areAllOriginsAllowed bool
+	// reflectOrigin will be true if the validated request origin should always be echoed
+	// (instead of using the "*" value). See Options.ReflectOrigin.
+	reflectOrigin bool
+	// privateNetworkOrigins is the compiled index of the origins that are allowed to request
+	// private network access. If nil, all allowed origins will be able to request it.
+	privateNetworkOrigins *originIndex
+	// originStore is the cached version of the OriginStore value in the attached Options
+	// instance. It will be nil if no OriginStore was set.
+	originStore *CachedOriginStore
 	// allowedMethods is a cleaned list of all of the HTTP methods that will be allowed.
 	allowedMethods []string
 	// allowedHeader is the cleaned list of all of the headers we will allow. If empty, and
@@ -29,8 +41,41 @@ type CORS struct {
 	// AllowedHeaders are empty as we will use a default set of headers. See docs for
 	// AllowedHeaders for details.
 	areAllHeadersAllowed bool
-	//
+	// exposedHeaders is the cleaned list of all of the headers that the client will be
+	// allowed to read from the response.
 	exposedHeaders []string
+	// areAllHeadersExposed will be true if the ExposedHeaders value in the attached Options
+	// instance contained the '*' value.
+	areAllHeadersExposed bool
+	// exposePatterns contains the lowercased patterns used to discover which response
+	// headers should be exposed (see Options.ExposeResponseHeaders).
+	exposePatterns []string
+	// exposeDenyPatterns contains the lowercased patterns for response headers that should
+	// never be discovered.
+	exposeDenyPatterns []string
+	// allowedHeaderSet contains the lowercased allowed headers for fast lookups.
+	allowedHeaderSet map[string]struct{}
+	// allowedHeaderPatterns contains the lowercased header patterns (e.g. x-acme-*).
+	allowedHeaderPatterns []string
+	// methodValues contains a pre-built header value for each allowed method.
+	methodValues map[string][]string
+	// preflightVary is the pre-built Vary header value for preflight responses.
+	preflightVary []string
+	// maxAgeValue is the pre-built Access-Control-Max-Age header value.
+	maxAgeValue []string
+	// exposedHeadersValue is the pre-built Access-Control-Expose-Headers header value.
+	exposedHeadersValue []string
+	// preflightCache contains the cached preflight decisions. It will be nil if the cache
+	// has not been enabled.
+	preflightCache *preflightCache
+	// tracer is the Tracer in the attached Options. It will be nil if tracing is disabled.
+	tracer Tracer
+	// observing will be true if decisions need to be reported to the Metrics or the Logger.
+	observing bool
+	// preflightSuccessStatus is the status code Handler will use for successful preflights.
+	preflightSuccessStatus int
+	// preflightFailureStatus is the status code Handler will use for failed preflights.
+	preflightFailureStatus int
 }
 
 // AllowAll creates a new CORS instance that allows all origins, methods, and
@@ -6,12 +6,20 @@
 
 package cors
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Code is the code that identifies the specific condition a ValidationError describes.
+type Code int
 
 const (
 	// ConfigurationInvalid means that you tried to configure the CORS instance or
 	// defined an Options combination that was invalid.
-	ConfigurationInvalid int = iota + 100
+	ConfigurationInvalid Code = iota + 100
 	// PreflightErrOriginNotAllowed means that the preflight failed because the origin
 	// was not whitelisted.
 	PreflightErrOriginNotAllowed
@@ -27,30 +35,240 @@ const (
 	// PreflightErrMethodInvalid means you're hitting the preflight but you aren't
 	// using the OPTIONS method.
 	PreflightErrMethodInvalid
+	// RequestErrOriginMissing means that the request did not include an Origin header
+	// and so it is not a CORS request.
+	RequestErrOriginMissing
+	// RequestErrOriginNotAllowed means that the actual request failed because the origin
+	// was not whitelisted.
+	RequestErrOriginNotAllowed
+	// RequestErrMethodNotAllowed means that the actual request failed because the http
+	// method was not whitelisted.
+	RequestErrMethodNotAllowed
+	// RequestErrIsPreflight means you tried to validate a preflight request as an actual
+	// request. Use ValidatePreflight instead.
+	RequestErrIsPreflight
+	// PreflightErrPrivateNetworkNotAllowed means that the preflight failed because it
+	// requested private network access and that wasn't allowed for the origin.
+	PreflightErrPrivateNetworkNotAllowed
+	// OriginInvalid means that an origin value could not be parsed because it was not a
+	// valid serialized origin.
+	OriginInvalid
+	// OriginLookupFailed means that the origin could not be validated because the dynamic
+	// origin lookup failed. See OriginalError for details.
+	OriginLookupFailed
+	// PolicyNotFound means that there was no policy that matched the request.
+	PolicyNotFound
 )
 
 // codedErrorMessages is a map of user friendly error messages for the numeric error
 // codes used in the system.
-var codedErrorMessages = map[int]string{
-	ConfigurationInvalid:          "one or more options were invalid",
-	PreflightErrOriginNotAllowed:  "the requested origin was not whitelisted",
-	PreflightErrMethodNotAllowed:  "the requested method was not whitelisted",
-	PreflightErrHeadersNotAllowed: "one or more headers were not whitelisted",
-	PreflightErrMethodMissing:     "you did not provide a http method for validation",
-	PreflightErrMethodInvalid:     "you atempted to validate a CORS request but you did the request was not sent using the OPTIONS http method",
+var codedErrorMessages = map[Code]string{
+	ConfigurationInvalid:                 "one or more options were invalid",
+	PreflightErrOriginNotAllowed:         "the requested origin was not whitelisted",
+	PreflightErrMethodNotAllowed:         "the requested method was not whitelisted",
+	PreflightErrHeadersNotAllowed:        "one or more headers were not whitelisted",
+	PreflightErrMethodMissing:            "you did not provide a http method for validation",
+	PreflightErrMethodInvalid:            "you atempted to validate a CORS request but you did the request was not sent using the OPTIONS http method",
+	RequestErrOriginMissing:              "the request did not include an origin",
+	RequestErrOriginNotAllowed:           "the request origin was not whitelisted",
+	RequestErrMethodNotAllowed:           "the request method was not whitelisted",
+	RequestErrIsPreflight:                "you attempted to validate a preflight request as an actual request",
+	PreflightErrPrivateNetworkNotAllowed: "private network access was not allowed for the requested origin",
+	OriginInvalid:                        "the value was not a valid serialized origin",
+	OriginLookupFailed:                   "the dynamic origin lookup failed",
+	PolicyNotFound:                       "there was no policy for the request",
+}
+
+// codeNames contains the name of each of the codes.
+var codeNames = map[Code]string{
+	ConfigurationInvalid:                 "ConfigurationInvalid",
+	PreflightErrOriginNotAllowed:         "PreflightErrOriginNotAllowed",
+	PreflightErrMethodNotAllowed:         "PreflightErrMethodNotAllowed",
+	PreflightErrHeadersNotAllowed:        "PreflightErrHeadersNotAllowed",
+	PreflightErrMethodMissing:            "PreflightErrMethodMissing",
+	PreflightErrMethodInvalid:            "PreflightErrMethodInvalid",
+	RequestErrOriginMissing:              "RequestErrOriginMissing",
+	RequestErrOriginNotAllowed:           "RequestErrOriginNotAllowed",
+	RequestErrMethodNotAllowed:           "RequestErrMethodNotAllowed",
+	RequestErrIsPreflight:                "RequestErrIsPreflight",
+	PreflightErrPrivateNetworkNotAllowed: "PreflightErrPrivateNetworkNotAllowed",
+	OriginInvalid:                        "OriginInvalid",
+	OriginLookupFailed:                   "OriginLookupFailed",
+	PolicyNotFound:                       "PolicyNotFound",
+}
+
+// String returns the name of the code (e.g. PreflightErrOriginNotAllowed). Unknown codes
+// are returned as Code(n).
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return "Code(" + strconv.Itoa(int(c)) + ")"
+}
+
+// MarshalText encodes the code as its name.
+func (c Code) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a code from its name (or its numeric value).
+func (c *Code) UnmarshalText(text []byte) error {
+	value := string(text)
+	for code, name := range codeNames {
+		if name == value {
+			*c = code
+			return nil
+		}
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("cors: unknown error code %q", value)
+	}
+	*c = Code(number)
+	return nil
+}
+
+// MarshalJSON encodes the code as its numeric value so that the JSON form of a
+// ValidationError stays the same as it has always been.
+func (c Code) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(int(c))), nil
+}
+
+// UnmarshalJSON decodes a code from its numeric value or from its name (as a string).
+func (c *Code) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		return c.UnmarshalText([]byte(name))
+	}
+	var number int
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("cors: invalid error code %s", data)
+	}
+	*c = Code(number)
+	return nil
 }
 
-// ValidationError will be thrown whenever there are validation or configuration issues
+// The sentinel errors below can be used with errors.Is to check for a category of
+// ValidationError. The preflight and actual request variations of a code match the same
+// sentinel. For example, errors.Is(err, ErrOriginNotAllowed) will be true for both the
+// PreflightErrOriginNotAllowed and RequestErrOriginNotAllowed codes.
+var (
+	// ErrConfigurationInvalid matches the ConfigurationInvalid code.
+	ErrConfigurationInvalid = errors.New("cors: configuration invalid")
+	// ErrOriginNotAllowed matches the PreflightErrOriginNotAllowed and
+	// RequestErrOriginNotAllowed codes.
+	ErrOriginNotAllowed = errors.New("cors: origin not allowed")
+	// ErrMethodNotAllowed matches the PreflightErrMethodNotAllowed and
+	// RequestErrMethodNotAllowed codes.
+	ErrMethodNotAllowed = errors.New("cors: method not allowed")
+	// ErrHeadersNotAllowed matches the PreflightErrHeadersNotAllowed code.
+	ErrHeadersNotAllowed = errors.New("cors: headers not allowed")
+	// ErrMethodMissing matches the PreflightErrMethodMissing code.
+	ErrMethodMissing = errors.New("cors: method missing")
+	// ErrMethodInvalid matches the PreflightErrMethodInvalid code.
+	ErrMethodInvalid = errors.New("cors: preflight method invalid")
+	// ErrOriginMissing matches the RequestErrOriginMissing code.
+	ErrOriginMissing = errors.New("cors: origin missing")
+	// ErrIsPreflight matches the RequestErrIsPreflight code.
+	ErrIsPreflight = errors.New("cors: request is a preflight")
+	// ErrPrivateNetworkNotAllowed matches the PreflightErrPrivateNetworkNotAllowed code.
+	ErrPrivateNetworkNotAllowed = errors.New("cors: private network access not allowed")
+	// ErrOriginInvalid matches the OriginInvalid code.
+	ErrOriginInvalid = errors.New("cors: origin invalid")
+	// ErrOriginLookupFailed matches the OriginLookupFailed code.
+	ErrOriginLookupFailed = errors.New("cors: origin lookup failed")
+	// ErrPolicyNotFound matches the PolicyNotFound code.
+	ErrPolicyNotFound = errors.New("cors: policy not found")
+)
+
+// codeSentinels maps each of the codes to its sentinel error.
+var codeSentinels = map[Code]error{
+	ConfigurationInvalid:                 ErrConfigurationInvalid,
+	PreflightErrOriginNotAllowed:         ErrOriginNotAllowed,
+	PreflightErrMethodNotAllowed:         ErrMethodNotAllowed,
+	PreflightErrHeadersNotAllowed:        ErrHeadersNotAllowed,
+	PreflightErrMethodMissing:            ErrMethodMissing,
+	PreflightErrMethodInvalid:            ErrMethodInvalid,
+	RequestErrOriginMissing:              ErrOriginMissing,
+	RequestErrOriginNotAllowed:           ErrOriginNotAllowed,
+	RequestErrMethodNotAllowed:           ErrMethodNotAllowed,
+	RequestErrIsPreflight:                ErrIsPreflight,
+	PreflightErrPrivateNetworkNotAllowed: ErrPrivateNetworkNotAllowed,
+	OriginInvalid:                        ErrOriginInvalid,
+	OriginLookupFailed:                   ErrOriginLookupFailed,
+	PolicyNotFound:                       ErrPolicyNotFound,
+}
+
+// ValidationError will be thrown whenever there are validation or configuration issues. It
+// is always used as a pointer (*ValidationError). Each rejected request gets its own
+// ValidationError so it can be modified by the handler.
 type ValidationError struct {
 	// Code provides a code that indicates the specific error condition
-	Code int `json:"code"`
+	Code Code `json:"code"`
 	// Message is a human readable explanation of the error condition
 	Message string `json:"message"`
-	// OriginalError contains the underlying source error (if any exists)
+	// OriginalError contains the underlying source error (if any exists). It is encoded
+	// as its message in JSON.
 	OriginalError error `json:"error,omitempty"`
+	// configKey is the Config key for the option that caused a ConfigurationInvalid error
+	// (if known). It is used by the config loaders to report where the error came from.
+	configKey string
 }
 
 // Error implements the builtin error interface for our custom ValidationError type
-func (ce ValidationError) Error() string {
-	return fmt.Sprintf("%s [%d]", ce.Message, ce.Code)
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("%s [%d]", ve.Message, ve.Code)
+}
+
+// Unwrap returns the OriginalError (if any exists).
+func (ve *ValidationError) Unwrap() error {
+	return ve.OriginalError
+}
+
+// Clone returns a copy of the ValidationError that can be safely modified.
+func (ve *ValidationError) Clone() *ValidationError {
+	clone := *ve
+	return &clone
+}
+
+// Is returns true if the target is the sentinel error for the code (e.g.
+// ErrOriginNotAllowed) or if the target is a (non-nil) *ValidationError with the same code.
+func (ve *ValidationError) Is(target error) bool {
+	if other, ok := target.(*ValidationError); ok {
+		return other != nil && other.Code == ve.Code
+	}
+	sentinel, ok := codeSentinels[ve.Code]
+	return ok && sentinel == target
+}
+
+// validationErrorJSON is the JSON form of a ValidationError.
+type validationErrorJSON struct {
+	Code          Code   `json:"code"`
+	Message       string `json:"message"`
+	OriginalError string `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the ValidationError. The OriginalError is encoded as its message.
+func (ve *ValidationError) MarshalJSON() ([]byte, error) {
+	encoded := validationErrorJSON{Code: ve.Code, Message: ve.Message}
+	if ve.OriginalError != nil {
+		encoded.OriginalError = ve.OriginalError.Error()
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes the ValidationError. If there was an original error message, the
+// OriginalError will be an error with that message.
+func (ve *ValidationError) UnmarshalJSON(data []byte) error {
+	var decoded validationErrorJSON
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	ve.Code = decoded.Code
+	ve.Message = decoded.Message
+	ve.OriginalError = nil
+	if decoded.OriginalError != "" {
+		ve.OriginalError = errors.New(decoded.OriginalError)
+	}
+	return nil
 }
@@ -7,13 +7,20 @@
 package cors_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/theyakka/cors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
 )
 
 func TestError(t *testing.T) {
-	code := 55
+	code := cors.Code(55)
 	message := "this is a validation error"
 	err := cors.ValidationError{
 		Code:          code,
@@ -26,3 +33,151 @@ func TestError(t *testing.T) {
 		t.Error("the expected error message was not outputted")
 	}
 }
+
+func TestErrorIs(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		AllowOriginFunc: func(ctx context.Context, r *http.Request, origin string) (bool, error) {
+			return false, io.ErrUnexpectedEOF
+		},
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var preflightErr error
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://acme.com"),
+		func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+			preflightErr = error
+		})
+	if !errors.Is(preflightErr, cors.ErrOriginLookupFailed) || errors.Is(preflightErr, cors.ErrOriginNotAllowed) {
+		t.Error("expected the error to match the origin lookup failed sentinel")
+	}
+	if !errors.Is(preflightErr, io.ErrUnexpectedEOF) {
+		t.Error("expected the original error to be unwrapped")
+	}
+	if !errors.Is(preflightErr, &cors.ValidationError{Code: cors.OriginLookupFailed}) {
+		t.Error("expected the error to match a ValidationError with the same code")
+	}
+	if errors.Is(preflightErr, (*cors.ValidationError)(nil)) {
+		t.Error("expected the error not to match a nil ValidationError")
+	}
+	var lookupErr *cors.ValidationError
+	if errors.As(preflightErr, &lookupErr) {
+		clone := lookupErr.Clone()
+		clone.Message = "changed"
+		if lookupErr.Message == "changed" || clone.Code != lookupErr.Code {
+			t.Error("expected Clone to return an independent copy")
+		}
+	}
+
+	requestErr := c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodDelete, "https://theyakka.com"))
+	if !errors.Is(requestErr, cors.ErrMethodNotAllowed) {
+		t.Error("expected the request error to match the method not allowed sentinel")
+	}
+
+	_, err = (&cors.Options{AllowCredentials: true}).NewCORS()
+	var validationErr *cors.ValidationError
+	if !errors.As(err, &validationErr) || !errors.Is(err, cors.ErrConfigurationInvalid) {
+		t.Error("expected NewCORS to return a *ValidationError")
+	}
+	_, err = cors.ParseOrigin("theyakka.com")
+	if !errors.Is(err, cors.ErrOriginInvalid) {
+		t.Error("expected ParseOrigin to return an invalid origin error")
+	}
+}
+
+func TestErrorsAreNotShared(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins:     []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		PreflightCacheSize: 10,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// handlers are free to modify the errors they are given
+	modify := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		error.Message = "modified"
+		error.Code = cors.Code(55)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; n++ {
+				c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://acme.com"), modify)
+				c.ValidateRequest(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://acme.com"), modify)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var preflightErr *cors.ValidationError
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://acme.com"),
+		func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+			preflightErr = error
+		})
+	requestErr := c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://acme.com"))
+	for _, err := range []*cors.ValidationError{preflightErr, requestErr} {
+		if err == nil || err.Message == "modified" || !errors.Is(err, cors.ErrOriginNotAllowed) {
+			t.Errorf("expected an unmodified origin not allowed error but got %v", err)
+		}
+	}
+}
+
+func TestCodeString(t *testing.T) {
+	tests := []struct {
+		code     cors.Code
+		expected string
+	}{
+		{cors.PreflightErrOriginNotAllowed, "PreflightErrOriginNotAllowed"},
+		{cors.PolicyNotFound, "PolicyNotFound"},
+		{cors.Code(55), "Code(55)"},
+	}
+	for _, test := range tests {
+		if test.code.String() != test.expected {
+			t.Errorf("expected %s but got %s", test.expected, test.code)
+		}
+	}
+
+	var decoded cors.Code
+	if err := decoded.UnmarshalText([]byte("PreflightErrHeadersNotAllowed")); err != nil ||
+		decoded != cors.PreflightErrHeadersNotAllowed {
+		t.Error("expected the code to be decoded from its name")
+	}
+	if err := decoded.UnmarshalText([]byte("NotACode")); err == nil {
+		t.Error("expected an unknown code name to be rejected")
+	}
+}
+
+func TestErrorJSON(t *testing.T) {
+	err := &cors.ValidationError{
+		Code:          cors.OriginLookupFailed,
+		Message:       "the dynamic origin lookup failed",
+		OriginalError: io.ErrUnexpectedEOF,
+	}
+	data, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Error(jsonErr)
+		return
+	}
+	expected := `{"code":112,"message":"the dynamic origin lookup failed","error":"unexpected EOF"}`
+	if string(data) != expected {
+		t.Errorf("expected %s but got %s", expected, data)
+	}
+	var decoded cors.ValidationError
+	if jsonErr := json.Unmarshal(data, &decoded); jsonErr != nil {
+		t.Error(jsonErr)
+		return
+	}
+	if decoded.Code != err.Code || decoded.Message != err.Message || decoded.OriginalError.Error() != "unexpected EOF" {
+		t.Errorf("unexpected decoded error: %+v", decoded)
+	}
+
+	var code cors.Code
+	if jsonErr := json.Unmarshal([]byte(`"RequestErrOriginMissing"`), &code); jsonErr != nil || code != cors.RequestErrOriginMissing {
+		t.Error("expected the code to be decoded from its name")
+	}
+}
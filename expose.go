@@ -0,0 +1,196 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// neverExposedHeaders contains the (lowercased) response headers that will never be
+// discovered, no matter which patterns are configured.
+var neverExposedHeaders = map[string]bool{
+	"set-cookie":  true,
+	"set-cookie2": true,
+}
+
+// exposeWriter wraps the http.ResponseWriter passed to the next handler so that the headers
+// set by the handler can be exposed just before the response headers are written. The
+// optional interfaces (http.Flusher, http.Hijacker, io.ReaderFrom and http.Pusher) are only
+// implemented by the types returned by withInterfaces, and only when the wrapped writer
+// implements them. All of them are available via Unwrap (see http.ResponseController).
+type exposeWriter struct {
+	http.ResponseWriter
+	c          *CORS
+	discovered bool
+}
+
+// WriteHeader discovers the headers to expose and then writes the response headers.
+func (ew *exposeWriter) WriteHeader(code int) {
+	// informational responses can be followed by the real response headers
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		ew.discover()
+	}
+	ew.ResponseWriter.WriteHeader(code)
+}
+
+// Write discovers the headers to expose (if the response headers haven't been written yet)
+// and then writes the data.
+func (ew *exposeWriter) Write(data []byte) (int, error) {
+	ew.discover()
+	return ew.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the wrapped http.ResponseWriter (see http.ResponseController).
+func (ew *exposeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// withInterfaces returns the exposeWriter as a type that implements the same optional
+// interfaces as the wrapped writer. The combinations used by net/http (HTTP/1 and HTTP/2)
+// are supported. For any other combination, only the interfaces that the wrapped writer
+// implements will be advertised.
+func (ew *exposeWriter) withInterfaces() http.ResponseWriter {
+	_, flusher := ew.ResponseWriter.(http.Flusher)
+	_, hijacker := ew.ResponseWriter.(http.Hijacker)
+	_, readerFrom := ew.ResponseWriter.(io.ReaderFrom)
+	_, pusher := ew.ResponseWriter.(http.Pusher)
+	switch {
+	case flusher && hijacker && readerFrom:
+		return &exposeHTTP1Writer{ew}
+	case flusher && pusher:
+		return &exposeHTTP2Writer{ew}
+	case flusher:
+		return &exposeFlushWriter{ew}
+	}
+	return ew
+}
+
+// flush discovers the headers to expose and then flushes the wrapped writer.
+func (ew *exposeWriter) flush() {
+	ew.discover()
+	ew.ResponseWriter.(http.Flusher).Flush()
+}
+
+// exposeFlushWriter is an exposeWriter that implements http.Flusher.
+type exposeFlushWriter struct {
+	*exposeWriter
+}
+
+// Flush implements http.Flusher.
+func (ew *exposeFlushWriter) Flush() {
+	ew.flush()
+}
+
+// exposeHTTP1Writer is an exposeWriter that implements http.Flusher, http.Hijacker and
+// io.ReaderFrom (like the net/http HTTP/1 response writer).
+type exposeHTTP1Writer struct {
+	*exposeWriter
+}
+
+// Flush implements http.Flusher.
+func (ew *exposeHTTP1Writer) Flush() {
+	ew.flush()
+}
+
+// Hijack implements http.Hijacker. Once the connection has been hijacked, no headers will
+// be discovered.
+func (ew *exposeHTTP1Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	ew.discovered = true
+	return ew.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// ReadFrom implements io.ReaderFrom so that the wrapped writer can still use sendfile.
+func (ew *exposeHTTP1Writer) ReadFrom(src io.Reader) (int64, error) {
+	ew.discover()
+	return ew.ResponseWriter.(io.ReaderFrom).ReadFrom(src)
+}
+
+// exposeHTTP2Writer is an exposeWriter that implements http.Flusher and http.Pusher (like
+// the net/http HTTP/2 response writer).
+type exposeHTTP2Writer struct {
+	*exposeWriter
+}
+
+// Flush implements http.Flusher.
+func (ew *exposeHTTP2Writer) Flush() {
+	ew.flush()
+}
+
+// Push implements http.Pusher.
+func (ew *exposeHTTP2Writer) Push(target string, opts *http.PushOptions) error {
+	return ew.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+// discover exposes all of the response headers that match the ExposeResponseHeaders
+// patterns. It only does the work once.
+func (ew *exposeWriter) discover() {
+	if ew.discovered {
+		return
+	}
+	ew.discovered = true
+	var headers []string
+	for key := range ew.ResponseWriter.Header() {
+		if ew.c.isHeaderDiscoverable(key) {
+			headers = append(headers, key)
+		}
+	}
+	if len(headers) == 0 {
+		return
+	}
+	// map iteration order is random so sort the headers to keep the value stable
+	sort.Strings(headers)
+	ExposeHeaders(ew.ResponseWriter, headers...)
+}
+
+// isHeaderDiscoverable returns true if the response header matches one of the
+// ExposeResponseHeaders patterns and none of the ExposeResponseHeadersDeny patterns.
+func (c *CORS) isHeaderDiscoverable(header string) bool {
+	var buffer [maxStackHeaderLength]byte
+	lower := lowerHeader(buffer[:0], header)
+	if neverExposedHeaders[string(lower)] || isSafelistedResponseHeader(string(lower)) ||
+		strings.HasPrefix(string(lower), "access-control-") {
+		return false
+	}
+	for _, pattern := range c.exposeDenyPatterns {
+		if headerPatternMatch(pattern, lower) {
+			return false
+		}
+	}
+	for _, pattern := range c.exposePatterns {
+		if headerPatternMatch(pattern, lower) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafelistedResponseHeader returns true if the (lowercased) header is a CORS-safelisted
+// response header. Those are always readable so they never need to be exposed.
+func isSafelistedResponseHeader(header string) bool {
+	for _, safelisted := range DefaultExposedHeaders {
+		if strings.EqualFold(safelisted, header) {
+			return true
+		}
+	}
+	return header == "content-length"
+}
+
+// newExposeWriter creates an exposeWriter for the response writer (if header discovery has
+// been enabled) so that the headers set by the next handler will be exposed. If there is
+// nothing to discover, nil will be returned.
+func (c *CORS) newExposeWriter(w http.ResponseWriter) *exposeWriter {
+	if len(c.exposePatterns) == 0 || c.areAllHeadersExposed {
+		// nothing to discover or everything is already exposed
+		return nil
+	}
+	return &exposeWriter{ResponseWriter: w, c: c}
+}
@@ -0,0 +1,144 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExposeResponseHeaders(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins:            []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		ExposedHeaders:            []string{"X-Request-Id"},
+		ExposeResponseHeaders:     []string{"X-*", "Link", "Set-Cookie"},
+		ExposeResponseHeadersDeny: []string{"X-Internal-*"},
+		AllowCredentials:          true,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "1")
+		w.Header().Set("X-Total-Count", "10")
+		w.Header().Set("X-Internal-Trace", "abc")
+		w.Header().Set("Link", "<https://theyakka.com/2>; rel=\"next\"")
+		w.Header().Set("Set-Cookie", "session=1")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Server", "yakka")
+		w.WriteHeader(http.StatusCreated)
+		// headers set after the response headers were written can't be discovered
+		w.Header().Set("X-Late", "1")
+		_, _ = w.Write([]byte("{}"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	expected := "X-Request-Id, Link, X-Total-Count"
+	if exposed := w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders); exposed != expected {
+		t.Errorf("expected '%s' but got '%s'", expected, exposed)
+	}
+	if w.Code != http.StatusCreated {
+		t.Error("expected the status code to be passed through")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://acme.com"))
+	if exposed := w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders); exposed != "" {
+		t.Errorf("expected no headers to be exposed for a disallowed origin but got '%s'", exposed)
+	}
+}
+
+func TestExposeResponseHeadersImplicitWrite(t *testing.T) {
+	c, err := (&cors.Options{ExposeResponseHeaders: []string{"X-*"}}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Page", "2")
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("expected the wrapped response writer to support flushing")
+		}
+		w.(http.Flusher).Flush()
+		w.Header().Set("X-Late", "1")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	expected := "Cache-Control, Content-Language, Content-Type, Expires, Last-Modified, Pragma, X-Page"
+	if exposed := w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders); exposed != expected {
+		t.Errorf("expected '%s' but got '%s'", expected, exposed)
+	}
+	if !w.Flushed {
+		t.Error("expected the response to have been flushed")
+	}
+}
+
+func TestExposeResponseHeadersNoWrite(t *testing.T) {
+	c, err := (&cors.Options{ExposeResponseHeaders: []string{"X-*"}}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// net/http writes an implicit 200 once the handler returns
+		w.Header().Set("X-Foo", "1")
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	if exposed := w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders); !strings.HasSuffix(exposed, ", X-Foo") {
+		t.Errorf("expected X-Foo to be exposed but got '%s'", exposed)
+	}
+}
+
+// plainResponseWriter hides all of the optional interfaces of the wrapped writer.
+type plainResponseWriter struct {
+	http.ResponseWriter
+}
+
+func TestExposeResponseWriterInterfaces(t *testing.T) {
+	c, err := (&cors.Options{ExposeResponseHeaders: []string{"X-*"}}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	type interfaces struct {
+		flusher, hijacker, readerFrom, pusher bool
+	}
+	results := make(chan interfaces, 1)
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got interfaces
+		_, got.flusher = w.(http.Flusher)
+		_, got.hijacker = w.(http.Hijacker)
+		_, got.readerFrom = w.(io.ReaderFrom)
+		_, got.pusher = w.(http.Pusher)
+		results <- got
+	}))
+
+	handler.ServeHTTP(plainResponseWriter{httptest.NewRecorder()}, buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	if got := <-results; got != (interfaces{}) {
+		t.Errorf("expected no optional interfaces but got %+v", got)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.DefaultClient.Do(buildActualRequest(http.MethodGet, server.URL))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_ = resp.Body.Close()
+	if got := <-results; got != (interfaces{flusher: true, hijacker: true, readerFrom: true}) {
+		t.Errorf("expected the HTTP/1 interfaces but got %+v", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import "net/http"
+
+// Handler wraps next in a net/http middleware that handles CORS for you. Valid preflight
+// requests are answered directly using the PreflightSuccessStatus and invalid ones are
+// rejected using the PreflightFailureStatus. OPTIONS requests that are not CORS preflights
+// are passed through to next. Actual requests are decorated with the CORS response headers
+// (if they are allowed) and then passed through to next. If Options.ExposeResponseHeaders
+// is set, the headers set by next will be discovered and exposed when the response headers
+// are written.
+//
+// Handler is a convenience built on top of ValidatePreflight and ApplyActualResponseHeaders.
+// If you need more control over the flow, use those functions directly.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serveHTTP(w, r, next)
+	})
+}
+
+// HandlerFunc is the same as Handler, but for http.HandlerFunc values.
+func (c *CORS) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return c.Handler(next).ServeHTTP
+}
+
+// policyFor implements the Policy interface.
+func (c *CORS) policyFor(r *http.Request) (*CORS, *http.Request) {
+	return c, r
+}
+
+// serveHTTP does the work for Handler.
+func (c *CORS) serveHTTP(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if IsPreflightRequest(r) {
+		c.ValidatePreflight(w, r, c.writePreflightResponse)
+		return
+	}
+	// we don't block actual requests that fail validation. the missing CORS headers
+	// will cause the browser to block the response.
+	if err := c.ApplyActualResponseHeaders(w, r); err == nil {
+		if ew := c.newExposeWriter(w); ew != nil {
+			next.ServeHTTP(ew.withInterfaces(), r)
+			// if the handler didn't write anything, net/http will write the response
+			// headers once we return so they still need to be discovered
+			ew.discover()
+			return
+		}
+	}
+	next.ServeHTTP(w, r)
+}
+
+// writePreflightResponse is the PreflightHandlerFunc used by Handler to finish off a
+// preflight request.
+func (c *CORS) writePreflightResponse(w http.ResponseWriter, r *http.Request, error *ValidationError) {
+	if error != nil {
+		w.WriteHeader(c.preflightFailureStatus)
+		return
+	}
+	w.WriteHeader(c.preflightSuccessStatus)
+}
+
+// IsPreflightRequest returns true if the request is a CORS preflight request. That is, it
+// uses the OPTIONS http method and includes both the Origin and the
+// Access-Control-Request-Method headers.
+func IsPreflightRequest(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get(HeaderKeyReqOrigin) != "" &&
+		r.Header.Get(HeaderKeyAccCtlReqMethod) != ""
+}
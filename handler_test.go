@@ -0,0 +1,102 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandlerValidPreflight(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins:         []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		AllowedHeaders:         cors.DefaultHeadersWith("Authorization"),
+		PreflightSuccessStatus: http.StatusOK,
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	nextCalled := false
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildPreflightRequest("https://theyakka.com"))
+	if nextCalled {
+		t.Error("expected the preflight to have been answered by the handler")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d but got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "https://theyakka.com" {
+		t.Error("expected the allow origin header to have been set")
+	}
+}
+
+func TestHandlerInvalidPreflight(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	handler := c.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the preflight to have been rejected by the handler")
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildPreflightRequest("https://google.com"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d but got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestHandlerNonCORSOptions(t *testing.T) {
+	c, err := cors.AllowAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	nextCalled := false
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+	}))
+	req, _ := http.NewRequest(http.MethodOptions, "https://theyakka.com", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if !nextCalled {
+		t.Error("expected a non-CORS OPTIONS request to have been passed through")
+	}
+}
+
+func TestHandlerActualRequest(t *testing.T) {
+	c, err := cors.AllowAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	nextCalled := false
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalled = true
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	if !nextCalled {
+		t.Error("expected the actual request to have been passed through")
+	}
+	if w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "*" {
+		t.Error("expected the allow origin header to have been set")
+	}
+}
@@ -0,0 +1,231 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HeaderKeyVary is the http header that tells caches which request headers affected the
+// response.
+const HeaderKeyVary = "Vary"
+
+const toLower = 'a' - 'A'
+
+// maxStackHeaderLength is the longest header name that will be normalized without
+// allocating.
+const maxStackHeaderLength = 64
+
+// The response header values below are shared by every response. They are assigned directly
+// into the header map (instead of using Header.Set) so that no allocations are needed. All
+// of the shared slices have len == cap so that any append made by other code will copy the
+// slice instead of modifying it.
+var (
+	headerValueAll  = []string{"*"}
+	headerValueTrue = []string{"true"}
+	varyOrigin      = []string{HeaderKeyReqOrigin}
+)
+
+// firstValue returns the first value in the header values (or an empty string).
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// AddVary adds the values to the Vary header of the response. The existing Vary values are
+// parsed so that values which are already present (compared case-insensitively) are not
+// added again, and the existing values are merged into a single header value. If the
+// response already varies on everything (Vary: *), nothing will be added. If one of the
+// values is "*", the Vary header will be replaced with "*".
+//
+// AddVary is used for all of the Vary values set by this library. It is exported so that
+// your handlers can safely add their own values. Duplicate and empty values are removed
+// even if the response doesn't have a Vary header yet.
+func AddVary(w http.ResponseWriter, values ...string) {
+	headers := w.Header()
+	for _, value := range values {
+		if strings.TrimSpace(value) == "*" {
+			headers[HeaderKeyVary] = headerValueAll
+			return
+		}
+	}
+	if len(headers[HeaderKeyVary]) == 0 {
+		if merged := mergeVary(nil, values); merged != "" {
+			headers[HeaderKeyVary] = []string{merged}
+		}
+		return
+	}
+	addVary(headers, values)
+}
+
+// addVary adds the values to the Vary header. If the header doesn't have a Vary value, the
+// values slice will be assigned directly, so it must only be used with the pre-built
+// values (which are already de-duplicated and have len == cap because they are shared).
+func addVary(headers http.Header, values []string) {
+	existing := headers[HeaderKeyVary]
+	if len(existing) == 0 {
+		if len(values) > 0 {
+			headers[HeaderKeyVary] = values
+		}
+		return
+	}
+	if varyContains(existing, "*") {
+		// the response already varies on everything
+		return
+	}
+	missing := false
+	for _, value := range values {
+		if value == "*" {
+			headers[HeaderKeyVary] = headerValueAll
+			return
+		}
+		if !varyContains(existing, value) {
+			missing = true
+		}
+	}
+	if !missing {
+		// this is the common case and it doesn't allocate
+		return
+	}
+	headers[HeaderKeyVary] = []string{mergeVary(existing, values)}
+}
+
+// mergeVary merges the existing Vary header values and the new values into a single value.
+// Duplicate (and empty) tokens are removed.
+func mergeVary(existing []string, values []string) string {
+	var merged strings.Builder
+	add := func(token string) {
+		token = strings.TrimSpace(token)
+		if token == "" || headerListContains(merged.String(), token) {
+			return
+		}
+		if merged.Len() > 0 {
+			merged.WriteString(", ")
+		}
+		merged.WriteString(token)
+	}
+	for _, line := range existing {
+		for _, token := range strings.Split(line, ",") {
+			add(token)
+		}
+	}
+	for _, value := range values {
+		add(value)
+	}
+	return merged.String()
+}
+
+// varyContains returns true if the Vary header values already contain the value.
+func varyContains(existing []string, value string) bool {
+	for _, line := range existing {
+		if headerListContains(line, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// headerListContains returns true if the comma separated list contains the value. The
+// comparison is case-insensitive.
+func headerListContains(list string, value string) bool {
+	for list != "" {
+		var token string
+		if i := strings.IndexByte(list, ','); i >= 0 {
+			token, list = list[:i], list[i+1:]
+		} else {
+			token, list = list, ""
+		}
+		if strings.EqualFold(strings.TrimSpace(token), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// areHeaderListsAllowed returns true if every header in the (comma separated) header lists
+// is allowed. It does not allocate for header names up to maxStackHeaderLength bytes.
+func (c *CORS) areHeaderListsAllowed(lists []string) bool {
+	for _, list := range lists {
+		for list != "" {
+			var header string
+			if i := strings.IndexByte(list, ','); i >= 0 {
+				header, list = list[:i], list[i+1:]
+			} else {
+				header, list = list, ""
+			}
+			header = strings.Trim(header, " \t")
+			if header != "" && !c.isHeaderAllowed(header) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHeaderAllowed returns true if the header name is in the allowed header set. The name is
+// lowercased into a stack buffer so that the lookup doesn't allocate.
+func (c *CORS) isHeaderAllowed(header string) bool {
+	var buffer [maxStackHeaderLength]byte
+	lower := lowerHeader(buffer[:0], header)
+	if _, ok := c.allowedHeaderSet[string(lower)]; ok {
+		return true
+	}
+	for _, pattern := range c.allowedHeaderPatterns {
+		if headerPatternMatch(pattern, lower) {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerHeader appends the lowercased header name to buffer. If buffer has enough capacity
+// then no allocations will be made.
+func lowerHeader(buffer []byte, header string) []byte {
+	for i := 0; i < len(header); i++ {
+		b := header[i]
+		if b >= 'A' && b <= 'Z' {
+			b += toLower
+		}
+		buffer = append(buffer, b)
+	}
+	return buffer
+}
+
+// headerPatternMatch returns true if the (lowercased) header name matches the pattern. A
+// '*' in the pattern matches any sequence of characters.
+func headerPatternMatch(pattern string, header []byte) bool {
+	// simple prefix patterns (e.g. x-acme-*) are by far the most common
+	if strings.IndexByte(pattern, '*') == len(pattern)-1 {
+		prefix := pattern[:len(pattern)-1]
+		return len(header) >= len(prefix) && string(header[:len(prefix)]) == prefix
+	}
+	// iterative glob matching with single star backtracking
+	p, h := 0, 0
+	star, match := -1, 0
+	for h < len(header) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, match = p, h
+			p++
+		case p < len(pattern) && pattern[p] == header[h]:
+			p++
+			h++
+		case star >= 0:
+			match++
+			p, h = star+1, match
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
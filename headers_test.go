@@ -0,0 +1,106 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAddVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		values   []string
+		expected string
+	}{
+		{"empty", nil, []string{"Origin"}, "Origin"},
+		{"merge", []string{"Accept-Encoding"}, []string{"Origin"}, "Accept-Encoding, Origin"},
+		{"merge lines", []string{"Accept-Encoding, origin", "Accept-Language"},
+			[]string{"Origin", "Access-Control-Request-Method"},
+			"Accept-Encoding, origin, Accept-Language, Access-Control-Request-Method"},
+		{"duplicates", []string{"Accept-Encoding,Accept-Encoding, , Cookie"}, []string{"cookie", "Origin"},
+			"Accept-Encoding, Cookie, Origin"},
+		{"already present", []string{"ORIGIN"}, []string{"Origin"}, "ORIGIN"},
+		{"existing wildcard", []string{"Accept, *"}, []string{"Origin"}, "Accept, *"},
+		{"new wildcard", []string{"Accept"}, []string{"Origin", "*"}, "*"},
+		{"empty with duplicates", nil, []string{"Origin", "origin", " ", "Accept"}, "Origin, Accept"},
+		{"empty with wildcard", nil, []string{"Origin", "origin", "*"}, "*"},
+		{"empty values", nil, []string{"", " "}, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		if test.existing != nil {
+			w.Header()[cors.HeaderKeyVary] = test.existing
+		}
+		cors.AddVary(w, test.values...)
+		if vary := w.Header()[cors.HeaderKeyVary]; len(vary) > 1 || strings.Join(vary, "") != test.expected {
+			t.Errorf("%s: expected '%s' but got %q", test.name, test.expected, vary)
+		}
+	}
+}
+
+func TestPreflightVary(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  *cors.Options
+		existing string
+		expected string
+	}{
+		{"restricted", &cors.Options{
+			AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+			AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		}, "", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers"},
+		{"all origins and headers", cors.OptionsAllowAll(), "", "Access-Control-Request-Method"},
+		{"private network", &cors.Options{
+			AllowedHeaders:        cors.DefaultHeadersWith("Authorization"),
+			AllowPrivateNetwork:   true,
+			PrivateNetworkOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		}, "", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers, Access-Control-Request-Private-Network"},
+		{"merged", &cors.Options{
+			AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+			AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		}, "Accept-Encoding, origin", "Accept-Encoding, origin, Access-Control-Request-Method, Access-Control-Request-Headers"},
+	}
+	for _, test := range tests {
+		c, err := test.options.NewCORS()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		if test.existing != "" {
+			w.Header().Set(cors.HeaderKeyVary, test.existing)
+		}
+		c.ValidatePreflight(w, buildPreflightRequest("https://theyakka.com"),
+			func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {})
+		if vary := strings.Join(w.Header()[cors.HeaderKeyVary], ", "); vary != test.expected {
+			t.Errorf("%s: expected '%s' but got '%s'", test.name, test.expected, vary)
+		}
+	}
+}
+
+func TestActualRequestVary(t *testing.T) {
+	c, err := (&cors.Options{AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")}}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// the response depends on the origin even if the origin isn't allowed
+	for _, origin := range []string{"https://theyakka.com", "https://acme.com"} {
+		w := httptest.NewRecorder()
+		w.Header().Set(cors.HeaderKeyVary, "Accept-Encoding")
+		_ = c.ApplyActualResponseHeaders(w, buildActualRequest(http.MethodGet, origin))
+		_ = c.ApplyActualResponseHeaders(w, buildActualRequest(http.MethodGet, origin))
+		if vary := strings.Join(w.Header()[cors.HeaderKeyVary], ", "); vary != "Accept-Encoding, Origin" {
+			t.Errorf("%s: expected the Vary values to be merged but got '%s'", origin, vary)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"strings"
+)
+
+// originIndex is a compiled form of a list of OriginMatchers that avoids having to check
+// every matcher for every origin. Exact origins are stored in a hash set, domain suffix,
+// port range and (simple) glob rules are stored in a trie keyed on the reversed host labels,
+// regular expressions are combined into a regexSet and everything else (CIDR,
+// funcs and custom matchers) is checked linearly. The index always reports the first
+// matching rule (in declaration order) so it behaves exactly the same as checking the
+// matchers one by one.
+type originIndex struct {
+	// matchers is the original list of matchers (used to report the matched rule)
+	matchers []OriginMatcher
+	// exact maps the normalized origin to the index of the first exact match rule
+	exact map[string]int
+	// hosts is the root of the reversed host label trie
+	hosts *labelNode
+	// regexes contains all of the regular expression rules
+	regexes *regexSet
+	// linear contains the indexes of the matchers that must be checked one by one
+	linear []int
+	// dynamic will be true if any of the matchers make decisions that can't be cached
+	dynamic bool
+}
+
+// labelNode is a single host label in the originIndex trie. Candidate rules found in the
+// trie are always confirmed using the matcher itself so that the trie only needs to narrow
+// down the list of candidates (via the host) rather than replicate the matching logic.
+type labelNode struct {
+	// children contains the nodes for literal labels
+	children map[string]*labelNode
+	// globs contains the nodes for labels that contain a single label wildcard (e.g. * or
+	// app-*)
+	globs []labelGlob
+	// rules contains the rules for hosts that end at this node
+	rules []int
+	// subtree contains the rules that match any host with at least one more label (e.g.
+	// **.theyakka.com or subdomains of a domain suffix)
+	subtree []int
+}
+
+// labelGlob is a wildcard label + the node it leads to.
+type labelGlob struct {
+	pattern string
+	node    *labelNode
+}
+
+// newOriginIndex compiles the matchers into an originIndex. The matchers should already
+// have been normalized (see normalizeMatches).
+func newOriginIndex(matchers []OriginMatcher) *originIndex {
+	idx := &originIndex{
+		matchers: matchers,
+		exact:    map[string]int{},
+		hosts:    &labelNode{},
+	}
+	var regexes []int
+	for i, matcher := range matchers {
+		if !isCacheableMatcher(matcher) {
+			idx.dynamic = true
+		}
+		switch m := matcher.(type) {
+		case *Match:
+			if m.Type == MatchTypeExact {
+				if _, exists := idx.exact[m.Value]; !exists {
+					idx.exact[m.Value] = i
+				}
+				continue
+			}
+			if m.Type == MatchTypeGlob && idx.addGlob(m.Value, i) {
+				continue
+			}
+			if m.Type == MatchTypeRegex && m.regex != nil {
+				regexes = append(regexes, i)
+				continue
+			}
+		case *DomainSuffixMatcher:
+			node := idx.hosts.insert(m.Suffix)
+			node.rules = append(node.rules, i)
+			node.subtree = append(node.subtree, i)
+			continue
+		case *PortRangeMatcher:
+			if !strings.ContainsRune(m.Host, ':') {
+				node := idx.hosts.insert(m.Host)
+				node.rules = append(node.rules, i)
+				continue
+			}
+		}
+		idx.linear = append(idx.linear, i)
+	}
+	idx.regexes = newRegexSet(matchers, regexes)
+	return idx
+}
+
+// addGlob adds the glob pattern to the host trie. It returns false if the pattern is too
+// complex to be indexed (in which case it should be checked linearly).
+func (idx *originIndex) addGlob(pattern string, i int) bool {
+	schemeEnd := strings.Index(pattern, "://")
+	if schemeEnd < 0 {
+		return false
+	}
+	host := pattern[schemeEnd+3:]
+	if portStart := strings.IndexByte(host, ':'); portStart >= 0 {
+		host = host[:portStart]
+	}
+	if host == "" || strings.ContainsAny(host, "/[]") {
+		return false
+	}
+	subtree := false
+	if strings.HasPrefix(host, "**") {
+		if host != "**" && !strings.HasPrefix(host, "**.") {
+			return false
+		}
+		subtree = true
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "**"), ".")
+	}
+	if strings.Contains(host, "**") {
+		return false
+	}
+	node := idx.hosts.insert(host)
+	if subtree {
+		node.subtree = append(node.subtree, i)
+	} else {
+		node.rules = append(node.rules, i)
+	}
+	return true
+}
+
+// insert returns the node for the host (creating any missing nodes along the way).
+func (n *labelNode) insert(host string) *labelNode {
+	node := n
+	for host != "" {
+		var label string
+		label, host = lastLabel(host)
+		if strings.ContainsRune(label, '*') {
+			node = node.glob(label)
+			continue
+		}
+		if node.children == nil {
+			node.children = map[string]*labelNode{}
+		}
+		child, ok := node.children[label]
+		if !ok {
+			child = &labelNode{}
+			node.children[label] = child
+		}
+		node = child
+	}
+	return node
+}
+
+// glob returns the child node for the wildcard label (creating it if needed).
+func (n *labelNode) glob(pattern string) *labelNode {
+	for _, g := range n.globs {
+		if g.pattern == pattern {
+			return g.node
+		}
+	}
+	node := &labelNode{}
+	n.globs = append(n.globs, labelGlob{pattern: pattern, node: node})
+	return node
+}
+
+// matches returns true if any of the rules match the origin.
+func (idx *originIndex) matches(origin Origin) bool {
+	return idx.match(origin) >= 0
+}
+
+// match returns the index of the first rule that matches the origin or -1 if none of the
+// rules match.
+func (idx *originIndex) match(origin Origin) int {
+	best := -1
+	if i, ok := idx.exact[origin.String()]; ok {
+		best = i
+	}
+	if !origin.Opaque && !strings.ContainsRune(origin.Host, ':') {
+		best = idx.hosts.search(idx.matchers, origin.Host, origin, best)
+	}
+	if idx.regexes != nil && (best < 0 || idx.regexes.rules[0] < best) {
+		best = idx.regexes.match(idx.matchers, origin.String(), best)
+	}
+	for _, i := range idx.linear {
+		if best >= 0 && i > best {
+			break
+		}
+		if idx.matchers[i].MatchesOrigin(origin) {
+			return i
+		}
+	}
+	return best
+}
+
+// rule returns the matcher for the index returned by match.
+func (idx *originIndex) rule(i int) OriginMatcher {
+	return idx.matchers[i]
+}
+
+// search walks the trie for the (remaining) host and returns the lowest matching rule
+// index (or best if there is no better match).
+func (n *labelNode) search(matchers []OriginMatcher, host string, origin Origin, best int) int {
+	if host == "" {
+		return firstMatch(matchers, n.rules, origin, best)
+	}
+	best = firstMatch(matchers, n.subtree, origin, best)
+	label, rest := lastLabel(host)
+	if child, ok := n.children[label]; ok {
+		best = child.search(matchers, rest, origin, best)
+	}
+	for _, g := range n.globs {
+		if globMatch(g.pattern, label) {
+			best = g.node.search(matchers, rest, origin, best)
+		}
+	}
+	return best
+}
+
+// firstMatch returns the lowest rule index (that is lower than best) which matches the
+// origin. If none match, best is returned.
+func firstMatch(matchers []OriginMatcher, rules []int, origin Origin, best int) int {
+	for _, i := range rules {
+		if best >= 0 && i > best {
+			break
+		}
+		if matchers[i].MatchesOrigin(origin) {
+			return i
+		}
+	}
+	return best
+}
+
+// lastLabel splits the last label off of the host.
+func lastLabel(host string) (label string, rest string) {
+	if i := strings.LastIndexByte(host, '.'); i >= 0 {
+		return host[i+1:], host[:i]
+	}
+	return host, ""
+}
@@ -0,0 +1,150 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"fmt"
+	"github.com/theyakka/cors"
+	"testing"
+)
+
+func TestOriginIndexMatchesLinear(t *testing.T) {
+	matchers := []cors.OriginMatcher{
+		cors.EM("https://theyakka.com"),
+		cors.EM("null"),
+		cors.WC("https://*.acme.com"),
+		cors.WC("https://app-*.acme.io:*"),
+		cors.WC("http*://**.glob.dev"),
+		cors.WC("https://api.*.multi.dev:8443"),
+		cors.WC("http*://localhost:*"),
+		cors.DomainSuffix("suffix.com", "https"),
+		cors.PortRange("http", "127.0.0.1", 3000, 3999),
+		cors.RX(`https://[a-z]+\.regex\.org`),
+		cors.CIDR("10.0.0.0/8"),
+		cors.MatchFunc("ipv6", func(origin cors.Origin) bool { return origin.Host == "::1" }),
+	}
+	origins := []string{
+		"https://theyakka.com", "https://theyakka.com:443", "http://theyakka.com", "null",
+		"https://x.acme.com", "https://x.y.acme.com", "https://acme.com", "https://x.acme.com:8443",
+		"https://app-one.acme.io:8443", "https://app-one.acme.io", "https://web.acme.io:8443",
+		"https://a.glob.dev", "http://a.b.glob.dev", "https://glob.dev", "ftp://a.glob.dev",
+		"https://api.eu.multi.dev:8443", "https://api.eu.multi.dev", "https://web.eu.multi.dev:8443",
+		"http://localhost:3000", "https://localhost:1", "http://localhost",
+		"https://suffix.com", "https://a.b.suffix.com", "http://a.suffix.com", "https://notsuffix.com",
+		"http://127.0.0.1:3000", "http://127.0.0.1:4000", "https://127.0.0.1:3000",
+		"https://abc.regex.org", "https://a1.regex.org",
+		"http://10.1.2.3", "http://11.1.2.3",
+		"http://[::1]", "http://[::2]",
+	}
+	c, err := (&cors.Options{AllowedOrigins: matchers}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, value := range origins {
+		origin, err := cors.ParseOrigin(value)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		expected := false
+		for _, matcher := range matchers {
+			if matcher.MatchesOrigin(origin) {
+				expected = true
+				break
+			}
+		}
+		if c.IsOriginAllowed(value) != expected {
+			t.Errorf("%s: expected the index to return %v", value, expected)
+		}
+	}
+}
+
+func TestOriginIndexMatchingRule(t *testing.T) {
+	matchers := []cors.OriginMatcher{
+		cors.RX(`https?://localhost:8[0-9]{3}`),
+		cors.RX(`(?i)https://(www)\.ACME\.com`),
+		cors.RX(`https://([a-z]+)\.(eu|us)\.theyakka\.com`),
+		cors.RX(`https://[a-z]+\.theyakka\.com`),
+		cors.RX(`https://(a|b)x\.dev|https://c\.dev`),
+		cors.RX(`https://[0-9]+\.numbers\.dev`),
+		cors.EM("https://app.theyakka.com"),
+		cors.RX(`http://.*`),
+	}
+	c, err := (&cors.Options{AllowedOrigins: matchers}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	tests := []struct {
+		origin   string
+		expected int
+	}{
+		{"http://localhost:8080", 0},
+		{"https://www.acme.com", 1},
+		{"https://app.eu.theyakka.com", 2},
+		{"https://app.theyakka.com", 3},
+		{"https://bx.dev", 4},
+		{"https://c.dev", 4},
+		{"https://123.numbers.dev", 5},
+		{"http://other.com", 7},
+		{"https://other.com", -1},
+	}
+	for _, test := range tests {
+		rule, ok := c.MatchingRule(test.origin)
+		if test.expected < 0 {
+			if ok {
+				t.Errorf("%s: expected no rule to match but got %s", test.origin, rule)
+			}
+			continue
+		}
+		if !ok || rule != matchers[test.expected] {
+			t.Errorf("%s: expected %s but got %v", test.origin, matchers[test.expected], rule)
+		}
+	}
+}
+
+func TestOriginIndexMatchingRuleWithoutSuffixes(t *testing.T) {
+	// none of the expressions have a literal suffix and some of them overlap, so the lowest
+	// matching rule has to be found in the combined expressions
+	var matchers []cors.OriginMatcher
+	for i := 0; i < 40; i++ {
+		matchers = append(matchers, cors.RX(fmt.Sprintf(`https://app-%d\.example\.(com|net)`, i)))
+		if i%10 == 5 {
+			matchers = append(matchers, cors.RX(`https://app-[0-9]+\.example\.(com|net)`))
+		}
+	}
+	matchers = append(matchers, cors.RX(`https://(x|y)\.(dev|io)`))
+	c, err := (&cors.Options{AllowedOrigins: matchers}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	origins := []string{"https://x.io", "https://z.io", "https://app-99.example.com"}
+	for i := 0; i < 40; i++ {
+		origins = append(origins, fmt.Sprintf("https://app-%d.example.net", i))
+	}
+	for _, origin := range origins {
+		expected := -1
+		for i, matcher := range matchers {
+			if matcher.(*cors.Match).Matches(origin) {
+				expected = i
+				break
+			}
+		}
+		rule, ok := c.MatchingRule(origin)
+		if expected < 0 {
+			if ok {
+				t.Errorf("%s: expected no rule to match but got %s", origin, rule)
+			}
+			continue
+		}
+		if !ok || rule != matchers[expected] {
+			t.Errorf("%s: expected %s but got %v", origin, matchers[expected], rule)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// LogLevel is the level that a decision will be logged at.
+type LogLevel int
+
+const (
+	// LogLevelDefault means that the default level for the decision should be used.
+	LogLevelDefault LogLevel = iota
+	// LogLevelDebug is the debug log level.
+	LogLevelDebug
+	// LogLevelInfo is the info log level.
+	LogLevelInfo
+	// LogLevelWarn is the warning log level.
+	LogLevelWarn
+	// LogLevelError is the error log level.
+	LogLevelError
+	// LogLevelOff means that the decisions will not be logged.
+	LogLevelOff
+)
+
+// String returns the name of the level (e.g. info).
+func (ll LogLevel) String() string {
+	switch ll {
+	case LogLevelDefault:
+		return "default"
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	case LogLevelOff:
+		return "off"
+	}
+	return "unknown"
+}
+
+// LogEntry contains the details of a decision that is being logged.
+type LogEntry struct {
+	// Message is a short description of the decision (e.g. cors preflight rejected).
+	Message string
+	// Decision is the decision that was made. Decision.Rule is the matched rule and
+	// Decision.Policy is the policy name.
+	Decision Decision
+	// Origin is the request origin.
+	Origin string
+	// Method is the requested method (the Access-Control-Request-Method value for a
+	// preflight).
+	Method string
+	// Headers contains the headers requested by a preflight.
+	Headers []string
+	// RejectedHeaders contains the requested headers that were not allowed.
+	RejectedHeaders []string
+	// Error is the validation error if the request was not allowed.
+	Error *ValidationError
+}
+
+// Logger is the interface that wraps decision logging. If Options.Logger is set, the CORS
+// instance will log the decision made for each preflight and actual request. See
+// NewSlogLogger for a log/slog adapter (Go 1.21+).
+type Logger interface {
+	// Enabled returns true if entries at the level will be logged. It is checked before
+	// the entry is built so that disabled levels are cheap.
+	Enabled(ctx context.Context, level LogLevel) bool
+	// LogDecision logs the entry at the level.
+	LogDecision(ctx context.Context, level LogLevel, entry LogEntry)
+}
+
+// logDecision logs the decision using the Logger in the attached Options.
+func (c *CORS) logDecision(r *http.Request, decision Decision, err *ValidationError) {
+	level := c.logLevel(decision)
+	if level == LogLevelOff {
+		return
+	}
+	ctx := r.Context()
+	logger := c.options.Logger
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	if err != nil && err.Code != OriginLookupFailed && c.options.LogRejectedSampling > 1 {
+		// only log every Nth rejection
+		if atomic.AddUint64(&c.rejectedLogCount, 1)%uint64(c.options.LogRejectedSampling) != 1 {
+			return
+		}
+	}
+	entry := LogEntry{
+		Decision: decision,
+		Origin:   r.Header.Get(HeaderKeyReqOrigin),
+		Method:   r.Method,
+		Error:    err,
+	}
+	if decision.Kind == DecisionPreflight {
+		entry.Method = r.Header.Get(HeaderKeyAccCtlReqMethod)
+		entry.Headers = splitHeaderLists(r.Header[HeaderKeyAccCtlReqHeaders])
+		if err != nil && err.Code == PreflightErrHeadersNotAllowed {
+			for _, header := range entry.Headers {
+				if !c.isHeaderAllowed(header) {
+					entry.RejectedHeaders = append(entry.RejectedHeaders, header)
+				}
+			}
+		}
+	}
+	if decision.Allowed {
+		entry.Message = "cors " + decision.Kind.String() + " allowed"
+	} else {
+		entry.Message = "cors " + decision.Kind.String() + " rejected"
+	}
+	logger.LogDecision(ctx, level, entry)
+}
+
+// logLevel returns the level the decision should be logged at.
+func (c *CORS) logLevel(decision Decision) LogLevel {
+	switch {
+	case decision.Allowed:
+		return levelOrDefault(c.options.LogAllowedLevel, LogLevelDebug)
+	case decision.Code == OriginLookupFailed:
+		return levelOrDefault(c.options.LogErrorLevel, LogLevelError)
+	case decision.Code == RequestErrOriginMissing:
+		// the request isn't a CORS request (e.g. it is a same-origin request)
+		return LogLevelOff
+	}
+	return levelOrDefault(c.options.LogRejectedLevel, LogLevelInfo)
+}
+
+// levelOrDefault returns the level, or the default level if it is LogLevelDefault.
+func levelOrDefault(level LogLevel, defaultLevel LogLevel) LogLevel {
+	if level == LogLevelDefault {
+		return defaultLevel
+	}
+	return level
+}
+
+// splitHeaderLists splits the (comma separated) header lists into the header names.
+func splitHeaderLists(lists []string) []string {
+	var headers []string
+	for _, list := range lists {
+		for _, header := range strings.Split(list, ",") {
+			if header = strings.Trim(header, " \t"); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
@@ -0,0 +1,121 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"context"
+	"errors"
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	minLevel cors.LogLevel
+	levels   []cors.LogLevel
+	entries  []cors.LogEntry
+}
+
+func (rl *recordingLogger) Enabled(ctx context.Context, level cors.LogLevel) bool {
+	return level >= rl.minLevel
+}
+
+func (rl *recordingLogger) LogDecision(ctx context.Context, level cors.LogLevel, entry cors.LogEntry) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.levels = append(rl.levels, level)
+	rl.entries = append(rl.entries, entry)
+}
+
+func TestLoggerEntries(t *testing.T) {
+	logger := &recordingLogger{minLevel: cors.LogLevelDebug}
+	rule := cors.EM("https://theyakka.com")
+	c, err := (&cors.Options{
+		Name:           "api",
+		AllowedOrigins: []cors.OriginMatcher{rule},
+		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		Logger:         logger,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"), handler)
+	req := buildPreflightRequest("https://theyakka.com")
+	req.Header.Set(cors.HeaderKeyAccCtlReqHeaders, "Authorization, X-Secret,X-Other")
+	c.ValidatePreflight(httptest.NewRecorder(), req, handler)
+	_ = c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodPost, "https://acme.com"))
+	// requests without an origin aren't CORS requests so they should never be logged
+	c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(logger.entries) != 3 {
+		t.Errorf("expected 3 entries but got %d", len(logger.entries))
+		return
+	}
+	allowed := logger.entries[0]
+	if logger.levels[0] != cors.LogLevelDebug || allowed.Message != "cors preflight allowed" ||
+		allowed.Origin != "https://theyakka.com" || allowed.Method != "get" ||
+		strings.Join(allowed.Headers, ",") != "Authorization,Content-Type" ||
+		allowed.Decision.Rule.String() != rule.String() || allowed.Decision.Policy != "api" {
+		t.Errorf("unexpected allowed entry: %+v", allowed)
+	}
+	rejected := logger.entries[1]
+	if logger.levels[1] != cors.LogLevelInfo || rejected.Message != "cors preflight rejected" ||
+		strings.Join(rejected.RejectedHeaders, ",") != "X-Secret,X-Other" ||
+		rejected.Error == nil || rejected.Error.Code != cors.PreflightErrHeadersNotAllowed {
+		t.Errorf("unexpected rejected entry: %+v", rejected)
+	}
+	actual := logger.entries[2]
+	if actual.Message != "cors actual rejected" || actual.Method != http.MethodPost ||
+		actual.Origin != "https://acme.com" || actual.Decision.Code != cors.RequestErrOriginNotAllowed {
+		t.Errorf("unexpected actual entry: %+v", actual)
+	}
+}
+
+func TestLoggerLevelsAndSampling(t *testing.T) {
+	logger := &recordingLogger{minLevel: cors.LogLevelInfo}
+	c, err := (&cors.Options{
+		AllowOriginFunc: func(ctx context.Context, r *http.Request, origin string) (bool, error) {
+			if origin == "https://broken.com" {
+				return false, errors.New("lookup failed")
+			}
+			return origin == "https://theyakka.com", nil
+		},
+		AllowedHeaders:      cors.DefaultHeadersWith("Authorization"),
+		LogRejectedLevel:    cors.LogLevelWarn,
+		LogRejectedSampling: 3,
+		Logger:              logger,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	// allowed requests are logged at debug by default (which is disabled)
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"), handler)
+	for i := 0; i < 7; i++ {
+		c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://acme.com"), handler)
+	}
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://broken.com"), handler)
+
+	expected := []cors.LogLevel{cors.LogLevelWarn, cors.LogLevelWarn, cors.LogLevelWarn, cors.LogLevelError}
+	if len(logger.levels) != len(expected) {
+		t.Errorf("expected %d entries but got %d", len(expected), len(logger.levels))
+		return
+	}
+	for i, level := range logger.levels {
+		if level != expected[i] {
+			t.Errorf("entry %d: expected %s but got %s", i, expected[i], level)
+		}
+	}
+}
@@ -6,13 +6,30 @@
 
 package cors
 
-import "regexp"
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
 
-// Match is a generic exact value or "wildcard" (via regex) matcher that can be used
-// whenever you need to match things in the system.
+// MatchType indicates how a Match will compare its value against an input.
+type MatchType int
+
+const (
+	// MatchTypeExact means the input must be exactly equal to the value.
+	MatchTypeExact MatchType = iota
+	// MatchTypeGlob means the value is a glob pattern. See NewWildcardMatch for details.
+	MatchTypeGlob
+	// MatchTypeRegex means the value is a regular expression. See NewRegexMatch for details.
+	MatchTypeRegex
+)
+
+// Match is a generic exact value, glob or regex matcher that can be used whenever you
+// need to match things in the system. Match implements the OriginMatcher interface.
 type Match struct {
 	Value      string
 	IsWildcard bool
+	Type       MatchType
 	regex      *regexp.Regexp
 }
 
@@ -21,21 +38,62 @@ func NewMatch(value string) *Match {
 	return &Match{
 		Value:      value,
 		IsWildcard: false,
+		Type:       MatchTypeExact,
 		regex:      nil,
 	}
 }
 
-// NewWildcardMatch defines a new Match that will have a wildcard component.
-// Note: this function will automatically apply boundaries to the pattern
-// to allow for exact matching of the pattern only.
+// NewWildcardMatch defines a new Match that uses a glob pattern. The pattern must match the
+// entire input. A single '*' matches any run of characters within a single host label (or
+// port) and will never cross a '.', ':' or '/'. A double '**' is the same, except that it can
+// cross '.' so that it can match multiple host labels. In the scheme, a '*' only matches an
+// optional 's' (so http*:// will not match a scheme like httpx://). Any other scheme must be
+// spelled out. For example:
+//
+//	https://*.theyakka.com   matches https://api.theyakka.com but not https://a.b.theyakka.com
+//	https://**.theyakka.com  matches both of the above
+//	http*://theyakka.com     matches http://theyakka.com and https://theyakka.com
+//	http://localhost:*       matches http://localhost on any (explicit) port
+//
+// Patterns are compared against normalized origins and so should be written in lowercase
+// without default ports.
 func NewWildcardMatch(pattern string) *Match {
-	boundaryPattern := `\b` + pattern + `\b`
-	regex := regexp.MustCompile(boundaryPattern)
+	return &Match{
+		Value:      strings.ToLower(pattern),
+		IsWildcard: true,
+		Type:       MatchTypeGlob,
+		regex:      nil,
+	}
+}
+
+// NewRegexMatch defines a new Match that uses a regular expression. The expression will
+// always be anchored so that it must match the entire input. If the expression cannot be
+// compiled then the function will panic.
+func NewRegexMatch(pattern string) *Match {
+	match, err := compileRegexMatch(pattern)
+	if err != nil {
+		panic("cors: " + err.Error())
+	}
+	return match
+}
+
+// compileRegexMatch does the work for NewRegexMatch but returns an error if the expression
+// cannot be compiled.
+func compileRegexMatch(pattern string) (*Match, error) {
+	// compile the expression on its own first so that errors don't include the anchors
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, err
+	}
+	regex, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, err
+	}
 	return &Match{
 		Value:      pattern,
 		IsWildcard: true,
+		Type:       MatchTypeRegex,
 		regex:      regex,
-	}
+	}, nil
 }
 
 // EM is a convenience function that wraps NewMatch for Exact Matches
@@ -43,19 +101,151 @@ func EM(value string) *Match {
 	return NewMatch(value)
 }
 
-// WC is a convenience function that wraps NewMatch for Wildcard Matches.
+// WC is a convenience function that wraps NewWildcardMatch for Wildcard (glob) Matches.
 func WC(pattern string) *Match {
-	match := NewWildcardMatch(pattern)
-	return match
+	return NewWildcardMatch(pattern)
+}
+
+// RX is a convenience function that wraps NewRegexMatch for Regex Matches.
+func RX(pattern string) *Match {
+	return NewRegexMatch(pattern)
+}
+
+// MatchesOrigin evaluates a parsed origin vs the Match instance to see if it matches. The
+// comparison is made against the normalized form of the origin.
+func (og *Match) MatchesOrigin(origin Origin) bool {
+	return og.Matches(origin.String())
 }
 
 // Matches evaluates an input vs the Match instance to see if it matches
 func (og *Match) Matches(input string) bool {
-	if !og.IsWildcard {
+	switch og.Type {
+	case MatchTypeGlob:
+		return globMatchOrigin(og.Value, input)
+	case MatchTypeRegex:
+		if og.regex == nil {
+			return false
+		}
+		return og.regex.MatchString(input)
+	default:
 		return og.Value == input
 	}
-	if og.regex == nil {
+}
+
+// String returns the value of the Match prefixed with the match type (e.g. glob:value).
+func (og *Match) String() string {
+	switch og.Type {
+	case MatchTypeGlob:
+		return "glob:" + og.Value
+	case MatchTypeRegex:
+		return "regex:" + og.Value
+	default:
+		return "exact:" + og.Value
+	}
+}
+
+// CacheableDecision implements the CacheableMatcher interface. Match decisions are always
+// cacheable.
+func (og *Match) CacheableDecision() bool {
+	return true
+}
+
+// MarshalText implements the encoding.TextMarshaler interface. The Match is encoded in the
+// same format as String (e.g. glob:https://*.theyakka.com).
+func (og *Match) MarshalText() ([]byte, error) {
+	return []byte(og.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface. The value should be
+// prefixed with the match type (exact:, glob: or regex:). If there is no prefix, the value
+// will be treated as an exact match.
+func (og *Match) UnmarshalText(text []byte) error {
+	value := string(text)
+	switch {
+	case strings.HasPrefix(value, "glob:"):
+		*og = *NewWildcardMatch(strings.TrimPrefix(value, "glob:"))
+	case strings.HasPrefix(value, "regex:"):
+		match, err := compileRegexMatch(strings.TrimPrefix(value, "regex:"))
+		if err != nil {
+			return err
+		}
+		*og = *match
+	case strings.HasPrefix(value, "exact:"):
+		*og = *NewMatch(strings.TrimPrefix(value, "exact:"))
+	default:
+		if value == "" {
+			return errors.New("empty match value")
+		}
+		*og = *NewMatch(value)
+	}
+	return nil
+}
+
+// isAnyOrigin returns true if the Match is the "*" (all origins) value.
+func (og *Match) isAnyOrigin() bool {
+	return og.Value == "*" && og.Type != MatchTypeRegex
+}
+
+// globMatch returns true if the glob pattern matches the entire value. See
+// NewWildcardMatch for the supported syntax.
+func globMatch(pattern string, value string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] != '*' {
+			if len(value) == 0 || pattern[0] != value[0] {
+				return false
+			}
+			pattern = pattern[1:]
+			value = value[1:]
+			continue
+		}
+		crossDots := len(pattern) > 1 && pattern[1] == '*'
+		if crossDots {
+			pattern = pattern[2:]
+		} else {
+			pattern = pattern[1:]
+		}
+		// try to match the rest of the pattern after consuming 0..n characters
+		for i := 0; ; i++ {
+			if globMatch(pattern, value[i:]) {
+				return true
+			}
+			if i == len(value) || !globCanConsume(value[i], crossDots) {
+				return false
+			}
+		}
+	}
+	return len(value) == 0
+}
+
+// globMatchOrigin is globMatch except that any wildcards in the scheme of the pattern can
+// only match an optional 's'.
+func globMatchOrigin(pattern string, value string) bool {
+	schemeEnd := strings.Index(pattern, "://")
+	if schemeEnd < 0 || strings.IndexByte(pattern[:schemeEnd], '*') < 0 {
+		return globMatch(pattern, value)
+	}
+	valueSchemeEnd := strings.Index(value, "://")
+	if valueSchemeEnd < 0 || !schemeGlobMatch(pattern[:schemeEnd], value[:valueSchemeEnd]) {
 		return false
 	}
-	return og.regex.MatchString(input)
+	return globMatch(pattern[schemeEnd:], value[valueSchemeEnd:])
+}
+
+// schemeGlobMatch returns true if the scheme pattern matches the entire scheme. Each
+// wildcard matches either nothing or a single 's'.
+func schemeGlobMatch(pattern string, scheme string) bool {
+	if pattern == "" {
+		return scheme == ""
+	}
+	if pattern[0] == '*' {
+		pattern = strings.TrimLeft(pattern, "*")
+		return schemeGlobMatch(pattern, scheme) ||
+			(len(scheme) > 0 && scheme[0] == 's' && schemeGlobMatch(pattern, scheme[1:]))
+	}
+	return len(scheme) > 0 && pattern[0] == scheme[0] && schemeGlobMatch(pattern[1:], scheme[1:])
+}
+
+// globCanConsume returns true if a wildcard is allowed to consume the character.
+func globCanConsume(b byte, crossDots bool) bool {
+	return b != '/' && b != ':' && (crossDots || b != '.')
 }
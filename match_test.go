@@ -0,0 +1,76 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	expectations := []struct {
+		pattern string
+		input   string
+		matches bool
+	}{
+		{"https://*.theyakka.com", "https://api.theyakka.com", true},
+		{"https://*.theyakka.com", "https://theyakka.com", false},
+		{"https://*.theyakka.com", "https://a.b.theyakka.com", false},
+		{"https://*.theyakka.com", "https://api.theyakka.com.evil.net", false},
+		{"https://*.theyakka.com", "https://evil.net/.theyakka.com", false},
+		{"https://*.theyakka.com", "https://api.theyakka.com:8443", false},
+		{"https://**.theyakka.com", "https://a.b.theyakka.com", true},
+		{"https://**.theyakka.com", "https://evil.net:1.theyakka.com", false},
+		{"http*://theyakka.com", "http://theyakka.com", true},
+		{"http*://theyakka.com", "https://theyakka.com", true},
+		{"http*://theyakka.com", "https://theyakka.com.evil.net", false},
+		{"http*://theyakka.com", "httpx://theyakka.com", false},
+		{"http*://theyakka.com", "httpss://theyakka.com", false},
+		{"http*://*.theyakka.com", "httpfoo://api.theyakka.com", false},
+		{"ws*://theyakka.com", "wss://theyakka.com", true},
+		{"http://localhost:*", "http://localhost:8080", true},
+		{"http://localhost:*", "http://localhost.evil.net:8080", false},
+		{"HTTPS://*.TheYakka.com", "https://api.theyakka.com", true},
+	}
+	for _, expectation := range expectations {
+		matches := cors.WC(expectation.pattern).Matches(expectation.input)
+		if matches != expectation.matches {
+			t.Errorf("expected %q matching %q to be %t", expectation.pattern, expectation.input, expectation.matches)
+		}
+	}
+}
+
+func TestRegexMatchIsAnchored(t *testing.T) {
+	match := cors.RX(`https?://theyakka\.com`)
+	if !match.Matches("https://theyakka.com") {
+		t.Error("expected the regex to match")
+	}
+	if match.Matches("https://theyakka.com.evil.net") || match.Matches("https://evil.net/https://theyakka.com") {
+		t.Error("expected the regex to be anchored")
+	}
+}
+
+func TestGlobOriginPreflight(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.WC("https://*.theyakka.com"), cors.WC("http*://theyakka.com")},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, origin := range []string{"https://api.theyakka.com", "https://API.theyakka.com:443", "http://theyakka.com"} {
+		if !c.IsOriginAllowed(origin) {
+			t.Errorf("expected %q to be allowed", origin)
+		}
+	}
+	for _, origin := range []string{"https://theyakka.com.evil.net", "https://api.theyakka.com:8443"} {
+		if c.IsOriginAllowed(origin) {
+			t.Errorf("expected %q to not be allowed", origin)
+		}
+	}
+}
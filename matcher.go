@@ -0,0 +1,238 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// OriginMatcher is the interface that wraps origin matching. Each of the values in
+// Options.AllowedOrigins is an OriginMatcher. The library ships with exact, glob and regex
+// matchers (see Match), as well as domain suffix, port range, CIDR and func based matchers.
+// You can implement your own if none of those suit your needs.
+type OriginMatcher interface {
+	// MatchesOrigin returns true if the parsed (and normalized) origin matches.
+	MatchesOrigin(origin Origin) bool
+	// String returns a human readable description of the rule. It is used when reporting
+	// which rule matched an origin.
+	String() string
+}
+
+// CacheableMatcher can be implemented by an OriginMatcher to indicate whether its decisions
+// can be stored in the preflight cache (see Options.PreflightCacheSize). Decisions made by
+// matchers that don't implement the interface are never cached.
+type CacheableMatcher interface {
+	// CacheableDecision returns true if the result of MatchesOrigin will always be the same
+	// for the same origin.
+	CacheableDecision() bool
+}
+
+// isCacheableMatcher returns true if the matcher's decisions can be cached.
+func isCacheableMatcher(matcher OriginMatcher) bool {
+	cm, ok := matcher.(CacheableMatcher)
+	return ok && cm.CacheableDecision()
+}
+
+// DomainSuffixMatcher matches any origin whose host is the suffix domain itself or any
+// subdomain of it (on any port).
+type DomainSuffixMatcher struct {
+	// Suffix is the normalized domain suffix (e.g. theyakka.com).
+	Suffix string
+	// Schemes optionally restricts the schemes that will be matched. If empty, then any
+	// scheme will be matched.
+	Schemes []string
+}
+
+// DomainSuffix creates a new DomainSuffixMatcher for the domain. Any leading "*." or "."
+// will be ignored. If the domain is not a valid host then the function will panic.
+func DomainSuffix(domain string, schemes ...string) *DomainSuffixMatcher {
+	domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+	suffix, err := normalizeHost(domain)
+	if err != nil {
+		panic("cors: invalid domain suffix " + strconv.Quote(domain) + ": " + err.Error())
+	}
+	return &DomainSuffixMatcher{
+		Suffix:  suffix,
+		Schemes: lowerAll(schemes),
+	}
+}
+
+// MatchesOrigin implements the OriginMatcher interface.
+func (dm *DomainSuffixMatcher) MatchesOrigin(origin Origin) bool {
+	if origin.Opaque || !schemeAllowed(dm.Schemes, origin.Scheme) {
+		return false
+	}
+	host := origin.Host
+	if host == dm.Suffix {
+		return true
+	}
+	return len(host) > len(dm.Suffix) &&
+		strings.HasSuffix(host, dm.Suffix) &&
+		host[len(host)-len(dm.Suffix)-1] == '.'
+}
+
+// String implements the OriginMatcher interface.
+func (dm *DomainSuffixMatcher) String() string {
+	return "suffix:" + dm.Suffix
+}
+
+// CacheableDecision implements the CacheableMatcher interface.
+func (dm *DomainSuffixMatcher) CacheableDecision() bool {
+	return true
+}
+
+// PortRangeMatcher matches origins with a specific scheme + host where the port falls in
+// an (inclusive) range. If the origin doesn't specify a port, the default port for the
+// scheme will be used for comparison.
+type PortRangeMatcher struct {
+	Scheme  string
+	Host    string
+	MinPort int
+	MaxPort int
+}
+
+// PortRange creates a new PortRangeMatcher. If the host is not a valid host then the
+// function will panic.
+func PortRange(scheme string, host string, minPort int, maxPort int) *PortRangeMatcher {
+	normalized, err := normalizeHost(host)
+	if ip := net.ParseIP(host); ip != nil {
+		normalized, err = ip.String(), nil
+	}
+	if err != nil {
+		panic("cors: invalid port range host " + strconv.Quote(host) + ": " + err.Error())
+	}
+	return &PortRangeMatcher{
+		Scheme:  strings.ToLower(scheme),
+		Host:    normalized,
+		MinPort: minPort,
+		MaxPort: maxPort,
+	}
+}
+
+// MatchesOrigin implements the OriginMatcher interface.
+func (pm *PortRangeMatcher) MatchesOrigin(origin Origin) bool {
+	if origin.Opaque || origin.Scheme != pm.Scheme || origin.Host != pm.Host {
+		return false
+	}
+	port := origin.Port
+	if port == 0 {
+		port = defaultPorts[origin.Scheme]
+	}
+	return port >= pm.MinPort && port <= pm.MaxPort
+}
+
+// String implements the OriginMatcher interface.
+func (pm *PortRangeMatcher) String() string {
+	return "ports:" + pm.Scheme + "://" + pm.Host + ":" +
+		strconv.Itoa(pm.MinPort) + "-" + strconv.Itoa(pm.MaxPort)
+}
+
+// CacheableDecision implements the CacheableMatcher interface.
+func (pm *PortRangeMatcher) CacheableDecision() bool {
+	return true
+}
+
+// CIDRMatcher matches origins whose host is an IP literal inside of a network.
+type CIDRMatcher struct {
+	Network *net.IPNet
+	// Schemes optionally restricts the schemes that will be matched. If empty, then any
+	// scheme will be matched.
+	Schemes []string
+}
+
+// CIDR creates a new CIDRMatcher from a CIDR notation network (e.g. 10.0.0.0/8). If the
+// value cannot be parsed then the function will panic.
+func CIDR(cidr string, schemes ...string) *CIDRMatcher {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic("cors: invalid CIDR " + strconv.Quote(cidr) + ": " + err.Error())
+	}
+	return &CIDRMatcher{
+		Network: network,
+		Schemes: lowerAll(schemes),
+	}
+}
+
+// MatchesOrigin implements the OriginMatcher interface.
+func (cm *CIDRMatcher) MatchesOrigin(origin Origin) bool {
+	if origin.Opaque || !schemeAllowed(cm.Schemes, origin.Scheme) {
+		return false
+	}
+	ip := net.ParseIP(origin.Host)
+	return ip != nil && cm.Network.Contains(ip)
+}
+
+// String implements the OriginMatcher interface.
+func (cm *CIDRMatcher) String() string {
+	return "cidr:" + cm.Network.String()
+}
+
+// CacheableDecision implements the CacheableMatcher interface.
+func (cm *CIDRMatcher) CacheableDecision() bool {
+	return true
+}
+
+// FuncMatcher matches origins using a function.
+type FuncMatcher struct {
+	// Name is used to describe the rule when reporting matches.
+	Name string
+	// Func returns true if the origin matches.
+	Func func(origin Origin) bool
+	// Cacheable, when set to true, allows the decisions made by Func to be stored in the
+	// preflight cache. Only set it if Func always returns the same result for an origin.
+	Cacheable bool
+}
+
+// MatchFunc creates a new FuncMatcher.
+func MatchFunc(name string, fn func(origin Origin) bool) *FuncMatcher {
+	return &FuncMatcher{
+		Name: name,
+		Func: fn,
+	}
+}
+
+// MatchesOrigin implements the OriginMatcher interface.
+func (fm *FuncMatcher) MatchesOrigin(origin Origin) bool {
+	return fm.Func != nil && fm.Func(origin)
+}
+
+// String implements the OriginMatcher interface.
+func (fm *FuncMatcher) String() string {
+	return "func:" + fm.Name
+}
+
+// CacheableDecision implements the CacheableMatcher interface.
+func (fm *FuncMatcher) CacheableDecision() bool {
+	return fm.Cacheable
+}
+
+// schemeAllowed returns true if schemes is empty or contains the scheme.
+func schemeAllowed(schemes []string, scheme string) bool {
+	if len(schemes) == 0 {
+		return true
+	}
+	for _, allowed := range schemes {
+		if allowed == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerAll returns a copy of the values converted to lowercase.
+func lowerAll(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	lowered := make([]string, 0, len(values))
+	for _, value := range values {
+		lowered = append(lowered, strings.ToLower(value))
+	}
+	return lowered
+}
@@ -0,0 +1,73 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"strings"
+	"testing"
+)
+
+func TestOriginMatchers(t *testing.T) {
+	expectations := []struct {
+		matcher cors.OriginMatcher
+		origin  string
+		matches bool
+	}{
+		{cors.EM("https://theyakka.com"), "https://theyakka.com", true},
+		{cors.DomainSuffix("theyakka.com"), "https://theyakka.com", true},
+		{cors.DomainSuffix("*.theyakka.com"), "https://a.b.theyakka.com:8443", true},
+		{cors.DomainSuffix("theyakka.com"), "https://eviltheyakka.com", false},
+		{cors.DomainSuffix("theyakka.com", "https"), "http://api.theyakka.com", false},
+		{cors.DomainSuffix("münchen.de"), "https://www.xn--mnchen-3ya.de", true},
+		{cors.PortRange("http", "localhost", 8000, 8999), "http://localhost:8022", true},
+		{cors.PortRange("http", "localhost", 8000, 8999), "http://localhost:9000", false},
+		{cors.PortRange("http", "localhost", 80, 80), "http://localhost", true},
+		{cors.PortRange("http", "localhost", 8000, 8999), "https://localhost:8022", false},
+		{cors.CIDR("10.0.0.0/8"), "http://10.1.2.3:3000", true},
+		{cors.CIDR("10.0.0.0/8"), "http://11.1.2.3", false},
+		{cors.CIDR("fd00::/8", "https"), "https://[fd00::1]", true},
+		{cors.CIDR("10.0.0.0/8"), "http://localhost", false},
+		{cors.MatchFunc("staging", func(origin cors.Origin) bool {
+			return strings.HasPrefix(origin.Host, "staging-")
+		}), "https://staging-42.theyakka.com", true},
+		{cors.DomainSuffix("theyakka.com"), "null", false},
+	}
+	for _, expectation := range expectations {
+		origin, err := cors.ParseOrigin(expectation.origin)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if expectation.matcher.MatchesOrigin(origin) != expectation.matches {
+			t.Errorf("expected %s matching %q to be %t", expectation.matcher, expectation.origin, expectation.matches)
+		}
+	}
+}
+
+func TestCustomOriginMatcher(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.EM("https://theyakka.com"),
+			cors.CIDR("192.168.0.0/16"),
+			cors.MatchFunc("null", func(origin cors.Origin) bool { return origin.Opaque }),
+		},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, origin := range []string{"https://theyakka.com", "http://192.168.1.10:8080", "null"} {
+		if !c.IsOriginAllowed(origin) {
+			t.Errorf("expected %q to be allowed", origin)
+		}
+	}
+	if c.IsOriginAllowed("http://10.0.0.1") {
+		t.Error("expected the origin to not be allowed")
+	}
+}
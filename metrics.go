@@ -0,0 +1,168 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DecisionKind is the kind of request that a Decision was made for.
+type DecisionKind int
+
+const (
+	// DecisionPreflight is a decision made by ValidatePreflight.
+	DecisionPreflight DecisionKind = iota
+	// DecisionActual is a decision made for an actual (non-preflight) request.
+	DecisionActual
+)
+
+// String returns the name of the kind (e.g. preflight).
+func (dk DecisionKind) String() string {
+	switch dk {
+	case DecisionPreflight:
+		return "preflight"
+	case DecisionActual:
+		return "actual"
+	}
+	return "unknown"
+}
+
+// Decision describes the outcome of validating a single request.
+type Decision struct {
+	// Kind is the kind of request that was validated.
+	Kind DecisionKind
+	// Allowed will be true if the request passed validation.
+	Allowed bool
+	// Code is the ValidationError code if the request failed validation. It will be 0 if
+	// the request was allowed.
+	Code Code
+	// Rule is the AllowedOrigins value that matched the origin. It will be nil if no value
+	// matched (e.g. all origins are allowed or the origin was allowed by the
+	// AllowOriginFunc or OriginStore).
+	Rule OriginMatcher
+	// Policy is the name of the policy that made the decision (see Options.Name).
+	Policy string
+	// Tenant is the ID of the tenant that was selected by a TenantSelector (if any).
+	Tenant string
+	// Cached will be true if the decision came from the preflight cache.
+	Cached bool
+	// Latency is how long the validation took.
+	Latency time.Duration
+}
+
+// Reason returns a short, stable description of the decision that is suitable for use as
+// a metric label. It will be "allowed" if the request passed validation.
+func (d Decision) Reason() string {
+	if d.Allowed {
+		return "allowed"
+	}
+	if reason, ok := codeReasons[d.Code]; ok {
+		return reason
+	}
+	return "code_" + strconv.Itoa(int(d.Code))
+}
+
+// codeReasons maps each of the error codes to the reason used for metrics. The preflight
+// and actual request variations share a reason because the kind is reported separately.
+var codeReasons = map[Code]string{
+	ConfigurationInvalid:                 "configuration_invalid",
+	PreflightErrOriginNotAllowed:         "origin_not_allowed",
+	PreflightErrMethodNotAllowed:         "method_not_allowed",
+	PreflightErrHeadersNotAllowed:        "headers_not_allowed",
+	PreflightErrMethodMissing:            "method_missing",
+	PreflightErrMethodInvalid:            "method_invalid",
+	RequestErrOriginMissing:              "origin_missing",
+	RequestErrOriginNotAllowed:           "origin_not_allowed",
+	RequestErrMethodNotAllowed:           "method_not_allowed",
+	RequestErrIsPreflight:                "is_preflight",
+	PreflightErrPrivateNetworkNotAllowed: "private_network_not_allowed",
+	OriginInvalid:                        "origin_invalid",
+	OriginLookupFailed:                   "origin_lookup_failed",
+	PolicyNotFound:                       "policy_not_found",
+}
+
+// Metrics is the interface that wraps decision reporting. If Options.Metrics is set, the
+// CORS instance will call ObserveDecision once for every preflight and actual request that
+// it validates. ObserveDecision is called on the request path so it should be fast and it
+// must be safe for concurrent use.
+type Metrics interface {
+	// ObserveDecision records the decision.
+	ObserveDecision(decision Decision)
+}
+
+// observeDecision reports the decision to the Metrics and the Logger in the attached
+// Options. It should only be called if c.observing is true.
+func (c *CORS) observeDecision(r *http.Request, kind DecisionKind, err *ValidationError, rule OriginMatcher, cached bool, start time.Time) {
+	decision := Decision{
+		Kind:    kind,
+		Allowed: err == nil,
+		Rule:    rule,
+		Policy:  c.options.Name,
+		Tenant:  TenantFromRequest(r),
+		Cached:  cached,
+		Latency: time.Since(start),
+	}
+	if err != nil {
+		decision.Code = err.Code
+	}
+	if c.options.Metrics != nil {
+		c.options.Metrics.ObserveDecision(decision)
+	}
+	if c.options.Logger != nil {
+		c.logDecision(r, decision, err)
+	}
+}
+
+// ExpvarMetrics is a Metrics implementation that publishes its counters using the expvar
+// package. The published map contains:
+//
+//	decisions   the number of decisions keyed by kind and reason (e.g. preflight.allowed)
+//	rules       the number of allowed requests keyed by the matching rule
+//	latency_ns  the total validation time (in nanoseconds) keyed by kind
+type ExpvarMetrics struct {
+	vars      *expvar.Map
+	decisions *expvar.Map
+	rules     *expvar.Map
+	latency   *expvar.Map
+}
+
+// NewExpvarMetrics creates a new ExpvarMetrics instance and publishes it using the name. If
+// name is empty, it will not be published (see Map). Like expvar.Publish, it will panic if
+// the name has already been published.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	em := &ExpvarMetrics{
+		vars:      new(expvar.Map).Init(),
+		decisions: new(expvar.Map).Init(),
+		rules:     new(expvar.Map).Init(),
+		latency:   new(expvar.Map).Init(),
+	}
+	em.vars.Set("decisions", em.decisions)
+	em.vars.Set("rules", em.rules)
+	em.vars.Set("latency_ns", em.latency)
+	if name != "" {
+		expvar.Publish(name, em.vars)
+	}
+	return em
+}
+
+// Map returns the map that contains all of the counters.
+func (em *ExpvarMetrics) Map() *expvar.Map {
+	return em.vars
+}
+
+// ObserveDecision implements the Metrics interface.
+func (em *ExpvarMetrics) ObserveDecision(decision Decision) {
+	kind := decision.Kind.String()
+	em.decisions.Add(kind+"."+decision.Reason(), 1)
+	if decision.Allowed && decision.Rule != nil {
+		em.rules.Add(decision.Rule.String(), 1)
+	}
+	em.latency.Add(kind, int64(decision.Latency))
+}
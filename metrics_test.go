@@ -0,0 +1,144 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	decisions []cors.Decision
+}
+
+func (rm *recordingMetrics) ObserveDecision(decision cors.Decision) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.decisions = append(rm.decisions, decision)
+}
+
+func TestMetricsDecisions(t *testing.T) {
+	metrics := &recordingMetrics{}
+	rule := cors.WC("https://*.theyakka.com")
+	c, err := (&cors.Options{
+		Name:               "api",
+		AllowedOrigins:     []cors.OriginMatcher{rule},
+		AllowedHeaders:     cors.DefaultHeadersWith("Authorization"),
+		PreflightCacheSize: 10,
+		Metrics:            metrics,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), buildPreflightRequest("https://app.theyakka.com"))
+	handler.ServeHTTP(httptest.NewRecorder(), buildPreflightRequest("https://app.theyakka.com"))
+	handler.ServeHTTP(httptest.NewRecorder(), buildPreflightRequest("https://acme.com"))
+	handler.ServeHTTP(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://app.theyakka.com"))
+	handler.ServeHTTP(httptest.NewRecorder(), buildActualRequest(http.MethodDelete, "https://app.theyakka.com"))
+	// requests without an origin aren't CORS requests so they aren't decisions
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expected := []cors.Decision{
+		{Kind: cors.DecisionPreflight, Allowed: true, Rule: rule},
+		{Kind: cors.DecisionPreflight, Allowed: true, Rule: rule, Cached: true},
+		{Kind: cors.DecisionPreflight, Code: cors.PreflightErrOriginNotAllowed},
+		{Kind: cors.DecisionActual, Allowed: true, Rule: rule},
+		{Kind: cors.DecisionActual, Code: cors.RequestErrMethodNotAllowed, Rule: rule},
+	}
+	if len(metrics.decisions) != len(expected) {
+		t.Errorf("expected %d decisions but got %d", len(expected), len(metrics.decisions))
+		return
+	}
+	for i, decision := range metrics.decisions {
+		e := expected[i]
+		if decision.Kind != e.Kind || decision.Allowed != e.Allowed || decision.Code != e.Code ||
+			decision.Rule != e.Rule || decision.Cached != e.Cached || decision.Policy != "api" {
+			t.Errorf("decision %d: expected %+v but got %+v", i, e, decision)
+		}
+		if decision.Latency <= 0 {
+			t.Errorf("decision %d: expected the latency to be recorded", i)
+		}
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	metrics := cors.NewExpvarMetrics("")
+	rule := cors.EM("https://theyakka.com")
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Allowed: true, Rule: rule, Latency: time.Microsecond})
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Allowed: true, Rule: rule, Latency: time.Microsecond})
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionActual, Code: cors.RequestErrOriginNotAllowed, Latency: time.Microsecond})
+
+	expected := `{"decisions": {"actual.origin_not_allowed": 1, "preflight.allowed": 2}, ` +
+		`"latency_ns": {"actual": 1000, "preflight": 2000}, "rules": {"` + rule.String() + `": 2}}`
+	if value := metrics.Map().String(); value != expected {
+		t.Errorf("expected %s but got %s", expected, value)
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := cors.NewPrometheusMetrics(0.001, 0.01)
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Allowed: true, Policy: "api", Latency: time.Millisecond / 2})
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Code: cors.PreflightErrHeadersNotAllowed,
+		Policy: "api", Latency: 5 * time.Millisecond})
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Code: cors.PreflightErrHeadersNotAllowed,
+		Policy: "api", Latency: time.Second})
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionActual, Code: 999, Policy: `a "quoted" name`})
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	expected := []string{
+		`cors_decisions_total{kind="actual",policy="a \"quoted\" name",result="rejected",reason="code_999"} 1`,
+		`cors_decisions_total{kind="preflight",policy="api",result="allowed",reason="allowed"} 1`,
+		`cors_decisions_total{kind="preflight",policy="api",result="rejected",reason="headers_not_allowed"} 2`,
+		`cors_decision_duration_seconds_bucket{kind="preflight",policy="api",le="0.001"} 1`,
+		`cors_decision_duration_seconds_bucket{kind="preflight",policy="api",le="0.01"} 2`,
+		`cors_decision_duration_seconds_bucket{kind="preflight",policy="api",le="+Inf"} 3`,
+		`cors_decision_duration_seconds_sum{kind="preflight",policy="api"} 1.0055`,
+		`cors_decision_duration_seconds_count{kind="preflight",policy="api"} 3`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("expected the output to contain: %s\n%s", line, body)
+		}
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Error("expected the text exposition format content type")
+	}
+}
+
+func TestPrometheusMetricsBuckets(t *testing.T) {
+	metrics := cors.NewPrometheusMetrics(0.01, 0.001, 0.001)
+	metrics.ObserveDecision(cors.Decision{Kind: cors.DecisionPreflight, Allowed: true, Latency: time.Millisecond / 2})
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+	if count := strings.Count(string(body), `le="0.001"`); count != 1 {
+		t.Errorf("expected the duplicate bucket to be removed but got %d of them:\n%s", count, body)
+	}
+
+	for _, bucket := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected a %v bucket to panic", bucket)
+				}
+			}()
+			cors.NewPrometheusMetrics(0.001, bucket)
+		}()
+	}
+}
@@ -7,29 +7,143 @@
 package cors
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Options represents the configurable elements of the CORS validation process.
 type Options struct {
+	// Name is an optional name for the policy. It is reported in the decisions passed to
+	// Metrics and Logger so that multiple policies can be told apart.
+	Name string
 	// AllowedOrigins should contain the list of origins you would like to whitelist.
-	// Origin definitions can be exact match origins, or contain wildcard components.
-	AllowedOrigins []*Match
+	// Origin definitions can be exact match origins, contain wildcard components or be
+	// any other OriginMatcher implementation.
+	AllowedOrigins []OriginMatcher
+	// AllowOriginFunc is an optional function that will be called to validate any origin
+	// that isn't matched by AllowedOrigins. The origin value passed to the function will be
+	// in its normalized form. If the function returns an error, validation will fail with
+	// the OriginLookupFailed code. If AllowOriginFunc is set, and AllowedOrigins is empty,
+	// then only the origins allowed by the function will be allowed.
+	AllowOriginFunc func(ctx context.Context, r *http.Request, origin string) (bool, error)
+	// OriginStore is an optional store that will be consulted for any origin that isn't
+	// allowed by AllowedOrigins or the AllowOriginFunc. The store will always be wrapped
+	// in a CachedOriginStore. If OriginStore is set, and AllowedOrigins is empty, then
+	// only the origins allowed by the store (or AllowOriginFunc) will be allowed.
+	OriginStore OriginStore
+	// OriginStoreCacheTTL is how long allowed origins returned by the OriginStore will be
+	// cached for. If zero, DefaultOriginStoreCacheTTL will be used. If negative, allowed
+	// origins will not be cached.
+	OriginStoreCacheTTL time.Duration
+	// OriginStoreNegativeCacheTTL is how long disallowed origins returned by the OriginStore
+	// will be cached for. If zero, DefaultOriginStoreNegativeCacheTTL will be used. If
+	// negative, disallowed origins will not be cached.
+	OriginStoreNegativeCacheTTL time.Duration
+	// OriginStoreTimeout is the maximum amount of time to wait for the OriginStore. If zero
+	// there is no timeout (other than the request context).
+	OriginStoreTimeout time.Duration
+	// OriginStoreFailOpen, when set to true, will allow the origin if the OriginStore
+	// returns an error or times out. The default value is false, which means validation
+	// will fail with the OriginLookupFailed code.
+	OriginStoreFailOpen bool
 	// The list of methods you want to whitelist.
 	AllowedMethods []string
-	// The list of headers you want to whitelist.
+	// The list of headers you want to whitelist. Values can be exact header names or
+	// patterns where '*' matches any sequence of characters (e.g. X-Acme-*). A single "*"
+	// value allows all headers.
 	AllowedHeaders []string
-	// ExposedHeaders indicates which headers can be exposed as part of the response.
+	// ExposedHeaders indicates which headers can be exposed as part of the response. The
+	// "*" value exposes all headers, but it can only be used when AllowCredentials is false.
+	// Additional headers can be exposed from inside your handler using ExposeHeaders.
 	ExposedHeaders []string
+	// ExposeResponseHeaders enables exposed header discovery for Handler. When the next
+	// handler writes the response headers, every header that matches one of these values
+	// will be exposed. Values can be exact header names or patterns where '*' matches any
+	// sequence of characters (e.g. X-*). Set-Cookie, the CORS-safelisted response headers
+	// and the Access-Control-* headers are never discovered.
+	ExposeResponseHeaders []string
+	// ExposeResponseHeadersDeny contains the header names or patterns that should never be
+	// discovered, even if they match ExposeResponseHeaders.
+	ExposeResponseHeadersDeny []string
 	// MaxAge is the value in seconds for how long the response to the preflight request
 	// can be cached for without sending another preflight request.
 	MaxAge int
 	// AllowCredentials, when set to true, will allow the request to include
 	// credentials such as cookies or otherwise. Note, you cannot set the value
-	// to true AND use wildcard values for other Options values. If you attempt
-	// to do so, there will be a configuration error. The default value is false.
+	// to true AND use wildcard values for other Options values (unless the origin is
+	// reflected, see ReflectOrigin). If you attempt to do so, there will be a
+	// configuration error. The default value is false.
 	AllowCredentials bool
+	// ReflectOrigin, when set to true, will always echo the validated request origin in the
+	// Access-Control-Allow-Origin header (and add Origin to the Vary header) instead of
+	// using the "*" value. Combined with AllowCredentials, it allows credentialed requests
+	// from any of the AllowedOrigins. ReflectOrigin cannot be used when all origins are
+	// allowed unless UnsafeReflectAnyOrigin is also set.
+	ReflectOrigin bool
+	// UnsafeReflectAnyOrigin, when set to true, allows ReflectOrigin to reflect any valid
+	// origin. Together with AllowCredentials, this allows ANY site to make credentialed
+	// requests on behalf of your users, so only use it if you really know what you are
+	// doing. The null origin is never reflected this way (it must be listed in
+	// AllowedOrigins). It has no effect unless ReflectOrigin is true.
+	UnsafeReflectAnyOrigin bool
+	// AllowPrivateNetwork, when set to true, will allow preflight requests that ask for
+	// private network access (via the Access-Control-Request-Private-Network header) to
+	// succeed. The default value is false.
+	AllowPrivateNetwork bool
+	// PrivateNetworkOrigins optionally restricts private network access to a subset of
+	// the allowed origins. If empty, and AllowPrivateNetwork is true, then all allowed
+	// origins will be granted private network access.
+	PrivateNetworkOrigins []OriginMatcher
+	// PreflightCacheSize is the maximum number of preflight decisions that will be cached.
+	// Decisions are keyed on the Origin, Access-Control-Request-Method,
+	// Access-Control-Request-Headers and Access-Control-Request-Private-Network values. The
+	// least recently used decisions are evicted first. The default value is 0, which
+	// disables the cache.
+	PreflightCacheSize int
+	// PreflightCacheTTL is how long preflight decisions will be cached for. If zero,
+	// DefaultPreflightCacheTTL will be used.
+	PreflightCacheTTL time.Duration
+	// PreflightCacheAllowOriginFunc, when set to true, allows decisions made by the
+	// AllowOriginFunc to be cached. Only set it if the function always returns the same
+	// result for an origin. Decisions made by dynamic origin matchers are only cached if
+	// they implement CacheableMatcher (see FuncMatcher.Cacheable).
+	PreflightCacheAllowOriginFunc bool
+	// PreflightCacheOriginStore, when set to true, allows decisions made by the OriginStore
+	// to be cached. Store lookup failures are never cached.
+	PreflightCacheOriginStore bool
+	// PreflightSuccessStatus is the http status code that Handler will respond with when
+	// a preflight request succeeds. The default value is 204 (No Content).
+	PreflightSuccessStatus int
+	// PreflightFailureStatus is the http status code that Handler will respond with when
+	// a preflight request fails. The default value is 403 (Forbidden).
+	PreflightFailureStatus int
+	// Metrics is optionally called with the decision made for each preflight and actual
+	// request. See ExpvarMetrics and PrometheusMetrics.
+	Metrics Metrics
+	// Logger is optionally used to log the decision made for each preflight and actual
+	// request. Requests without an Origin header are not CORS requests and are never
+	// logged. See NewSlogLogger.
+	Logger Logger
+	// LogAllowedLevel is the level allowed requests are logged at. The default is
+	// LogLevelDebug.
+	LogAllowedLevel LogLevel
+	// LogRejectedLevel is the level rejected requests are logged at. The default is
+	// LogLevelInfo.
+	LogRejectedLevel LogLevel
+	// LogErrorLevel is the level that dynamic origin lookup failures are logged at. The
+	// default is LogLevelError.
+	LogErrorLevel LogLevel
+	// LogRejectedSampling, when greater than 1, means that only one of every
+	// LogRejectedSampling rejections will be logged. Origin lookup failures are never
+	// sampled. The default value is 0, which logs every rejection.
+	LogRejectedSampling int
+	// Tracer is optionally used to start spans around the validation of each request,
+	// origin matching, dynamic origin lookups and header validation. The default is
+	// NoopTracer.
+	Tracer Tracer
 }
 
 // OptionsAllowAll creates a default set of options that allows all origins,
@@ -46,43 +160,234 @@ func OptionsAllowAll() *Options {
 }
 
 // NewCORS creates a new CORS instance that is pre-configured with the values
-// defined in the current Options instance.
+// defined in the current Options instance. The CORS instance keeps its own copy of the
+// Options so changing the Options afterwards will not affect it.
 func (o *Options) NewCORS() (*CORS, error) {
+	o = o.clone()
 	c := &CORS{}
-	o.applyAllowedOrigins(c)
+	if err := o.applyAllowedOrigins(c); err != nil {
+		return nil, err
+	}
 	o.applyAllowedMethods(c)
 	o.applyAllowedHeaders(c)
 	o.applyExposedHeaders(c)
-	if o.AllowCredentials && (c.areAllOriginsAllowed || c.areAllHeadersAllowed) {
-		return nil, ValidationError{
+	privateNetworkOrigins, err := normalizeMatches(o.PrivateNetworkOrigins, "private_network_origins")
+	if err != nil {
+		return nil, err
+	}
+	if len(privateNetworkOrigins) > 0 {
+		c.privateNetworkOrigins = newOriginIndex(privateNetworkOrigins)
+	}
+	if o.OriginStore != nil {
+		c.originStore = NewCachedOriginStore(o.OriginStore, o.OriginStoreCacheTTL,
+			o.OriginStoreNegativeCacheTTL, o.OriginStoreTimeout)
+	}
+	c.reflectOrigin = o.ReflectOrigin
+	if c.reflectOrigin && c.areAllOriginsAllowed && !o.UnsafeReflectAnyOrigin {
+		return nil, &ValidationError{
+			Code:          ConfigurationInvalid,
+			Message:       "you cannot use the ReflectOrigin option when all origins are allowed unless UnsafeReflectAnyOrigin has been set",
+			OriginalError: nil,
+			configKey:     "reflect_origin",
+		}
+	}
+	if o.AllowCredentials && ((c.areAllOriginsAllowed && !c.reflectOrigin) || c.areAllHeadersAllowed) {
+		return nil, &ValidationError{
 			Code:          ConfigurationInvalid,
 			Message:       "you cannot use the AllowCredentials option when a wildcard origin or header value has been set",
 			OriginalError: nil,
+			configKey:     "allow_credentials",
 		}
 	}
+	if o.AllowCredentials && c.areAllHeadersExposed {
+		return nil, &ValidationError{
+			Code:          ConfigurationInvalid,
+			Message:       "you cannot use the AllowCredentials option when the wildcard exposed header value has been set",
+			OriginalError: nil,
+			configKey:     "allow_credentials",
+		}
+	}
+	c.buildHeaderValues(o)
+	c.observing = o.Metrics != nil || o.Logger != nil
+	if _, noop := o.Tracer.(NoopTracer); o.Tracer != nil && !noop {
+		c.tracer = o.Tracer
+	}
+	if o.PreflightCacheSize > 0 {
+		c.preflightCache = newPreflightCache(o.PreflightCacheSize, o.PreflightCacheTTL)
+	}
+	if o.PreflightSuccessStatus == 0 {
+		c.preflightSuccessStatus = http.StatusNoContent
+	} else {
+		c.preflightSuccessStatus = o.PreflightSuccessStatus
+	}
+	if o.PreflightFailureStatus == 0 {
+		c.preflightFailureStatus = http.StatusForbidden
+	} else {
+		c.preflightFailureStatus = o.PreflightFailureStatus
+	}
 	c.options = o
 	return c, nil
 }
 
-// applyAllowedOrigins checks for the "*" value and will
-func (o *Options) applyAllowedOrigins(c *CORS) {
-	if o.AllowedOrigins == nil || len(o.AllowedOrigins) == 0 {
+// clone creates a copy of the Options (including copies of all of the slices) so that the
+// caller can't change the values out from underneath us.
+func (o *Options) clone() *Options {
+	clone := *o
+	clone.AllowedOrigins = append([]OriginMatcher(nil), o.AllowedOrigins...)
+	clone.AllowedMethods = append([]string(nil), o.AllowedMethods...)
+	clone.AllowedHeaders = append([]string(nil), o.AllowedHeaders...)
+	clone.ExposedHeaders = append([]string(nil), o.ExposedHeaders...)
+	clone.ExposeResponseHeaders = append([]string(nil), o.ExposeResponseHeaders...)
+	clone.ExposeResponseHeadersDeny = append([]string(nil), o.ExposeResponseHeadersDeny...)
+	clone.PrivateNetworkOrigins = append([]OriginMatcher(nil), o.PrivateNetworkOrigins...)
+	return &clone
+}
+
+// Validate checks the Options for configuration errors. It returns the same errors that
+// NewCORS would.
+func (o *Options) Validate() error {
+	_, err := o.NewCORS()
+	return err
+}
+
+// Warnings returns a description of each of the risky (but valid) choices in the Options.
+// It is intended to be logged, or checked in tests, after the Options have been validated.
+// Reloadable reports the warnings for each policy it applies via its error callback.
+func (o *Options) Warnings() []string {
+	var warnings []string
+	allOrigins := len(o.AllowedOrigins) == 0 && o.AllowOriginFunc == nil && o.OriginStore == nil
+	for _, origin := range o.AllowedOrigins {
+		match, ok := origin.(*Match)
+		if !ok {
+			continue
+		}
+		if match.isAnyOrigin() {
+			allOrigins = true
+		} else if o.AllowCredentials && !match.IsWildcard && match.Value == OriginNull {
+			warnings = append(warnings, "the null origin is allowed with credentials. sandboxed "+
+				"iframes and local files on any site can send the null origin")
+		}
+	}
+	if o.UnsafeReflectAnyOrigin {
+		switch {
+		case !o.ReflectOrigin:
+			warnings = append(warnings, "UnsafeReflectAnyOrigin has no effect unless ReflectOrigin is set")
+		case allOrigins && o.AllowCredentials:
+			warnings = append(warnings, "any origin (except null) will be reflected with credentials. "+
+				"any site can make credentialed requests on behalf of your users")
+		case allOrigins:
+			warnings = append(warnings, "any origin will be reflected")
+		}
+	}
+	if o.AllowCredentials && o.OriginStore != nil && o.OriginStoreFailOpen {
+		warnings = append(warnings, "OriginStoreFailOpen is set with credentials. any origin will "+
+			"be allowed to make credentialed requests while the OriginStore is failing")
+	}
+	return warnings
+}
+
+// applyAllowedOrigins checks for the "*" value and will normalize any exact match origins
+// so that they can be compared against parsed request origins.
+func (o *Options) applyAllowedOrigins(c *CORS) error {
+	if len(o.AllowedOrigins) == 0 && (o.AllowOriginFunc != nil || o.OriginStore != nil) {
+		// the function / store will decide which origins are allowed
+		c.areAllOriginsAllowed = false
+		c.allowedOrigins = nil
+		return nil
+	}
+	if len(o.AllowedOrigins) == 0 {
 		// no allowed origins so we're going to assume that you want to allow everything
 		// (vs nothing .. as that would be weird)
 		c.areAllOriginsAllowed = true
 		c.allowedOrigins = nil
-	} else {
-		for _, origin := range o.AllowedOrigins {
-			if origin.Matches("*") {
-				// if we're allowing all origins then it's irrelevant to keep the old list
-				// so we will just stop here
-				c.areAllOriginsAllowed = true
-				c.allowedOrigins = nil
-				return
+		return nil
+	}
+	for _, origin := range o.AllowedOrigins {
+		if match, ok := origin.(*Match); ok && match.isAnyOrigin() {
+			// if we're allowing all origins then it's irrelevant to keep the old list
+			// so we will just stop here
+			c.areAllOriginsAllowed = true
+			c.allowedOrigins = nil
+			return nil
+		}
+	}
+	allowedOrigins, err := normalizeMatches(o.AllowedOrigins, "allowed_origins")
+	if err != nil {
+		return err
+	}
+	c.allowedOrigins = newOriginIndex(allowedOrigins)
+	c.areAllOriginsAllowed = false
+	return nil
+}
+
+// normalizeMatches returns a copy of the matchers where all of the exact match values have
+// been converted to their normalized origin form. If an exact match value is not a valid
+// origin then a configuration error (for the Config key) will be returned.
+func normalizeMatches(matchers []OriginMatcher, configKey string) ([]OriginMatcher, error) {
+	normalized := make([]OriginMatcher, 0, len(matchers))
+	for _, matcher := range matchers {
+		match, ok := matcher.(*Match)
+		if !ok || match.IsWildcard {
+			normalized = append(normalized, matcher)
+			continue
+		}
+		origin, err := ParseOrigin(match.Value)
+		if err != nil {
+			return nil, &ValidationError{
+				Code:          ConfigurationInvalid,
+				Message:       "one or more of the exact match origins was not a valid origin",
+				OriginalError: err,
+				configKey:     configKey,
 			}
-			c.allowedOrigins = append(c.allowedOrigins, origin)
 		}
-		c.areAllOriginsAllowed = false
+		normalized = append(normalized, NewMatch(origin.String()))
+	}
+	return normalized, nil
+}
+
+// buildHeaderValues pre-builds all of the static response header values so that they don't
+// need to be built for every request.
+func (c *CORS) buildHeaderValues(o *Options) {
+	c.methodValues = map[string][]string{
+		http.MethodOptions: {http.MethodOptions},
+	}
+	for _, method := range c.allowedMethods {
+		c.methodValues[method] = []string{method}
+	}
+	// also add the lowercase version of each method so that lowercase request values can
+	// be checked without having to convert them first
+	for method, value := range c.methodValues {
+		c.methodValues[strings.ToLower(method)] = value
+	}
+	c.allowedHeaderSet = make(map[string]struct{}, len(c.allowedHeaders))
+	for _, header := range c.allowedHeaders {
+		c.allowedHeaderSet[strings.ToLower(header)] = struct{}{}
+	}
+	// only vary on the request headers that can actually affect the preflight response
+	if !c.areAllOriginsAllowed || c.reflectOrigin || (o.AllowPrivateNetwork && c.privateNetworkOrigins != nil) {
+		c.preflightVary = append(c.preflightVary, HeaderKeyReqOrigin)
+	}
+	// the requested method is always echoed
+	c.preflightVary = append(c.preflightVary, HeaderKeyAccCtlReqMethod)
+	if !c.areAllHeadersAllowed {
+		c.preflightVary = append(c.preflightVary, HeaderKeyAccCtlReqHeaders)
+	}
+	if o.AllowPrivateNetwork {
+		c.preflightVary = append(c.preflightVary, HeaderKeyAccCtlReqPrivateNetwork)
+	}
+	// the values are shared by all responses so make sure an append always copies
+	c.preflightVary = c.preflightVary[:len(c.preflightVary):len(c.preflightVary)]
+	if o.MaxAge > 0 {
+		c.maxAgeValue = []string{strconv.Itoa(o.MaxAge)}
+	}
+	if len(c.exposedHeaders) > 0 {
+		c.exposedHeadersValue = []string{strings.Join(c.exposedHeaders, ", ")}
+	}
+	for _, pattern := range o.ExposeResponseHeaders {
+		c.exposePatterns = append(c.exposePatterns, strings.ToLower(strings.TrimSpace(pattern)))
+	}
+	for _, pattern := range o.ExposeResponseHeadersDeny {
+		c.exposeDenyPatterns = append(c.exposeDenyPatterns, strings.ToLower(strings.TrimSpace(pattern)))
 	}
 }
 
@@ -111,6 +416,11 @@ func (o *Options) applyAllowedHeaders(c *CORS) {
 				c.allowedHeaders = nil
 				return
 			}
+			if strings.ContainsRune(header, '*') {
+				// header patterns (e.g. X-Acme-*) are matched separately
+				c.allowedHeaderPatterns = append(c.allowedHeaderPatterns, strings.ToLower(header))
+				continue
+			}
 			c.allowedHeaders = append(c.allowedHeaders, http.CanonicalHeaderKey(header))
 		}
 		c.areAllHeadersAllowed = false
@@ -122,6 +432,12 @@ func (o *Options) applyExposedHeaders(c *CORS) {
 		c.exposedHeaders = DefaultExposedHeaders
 	} else {
 		for _, header := range o.ExposedHeaders {
+			if header == "*" {
+				// the Fetch spec treats "*" as all headers (for requests without credentials)
+				c.areAllHeadersExposed = true
+				c.exposedHeaders = []string{"*"}
+				return
+			}
 			c.exposedHeaders = append(c.exposedHeaders, http.CanonicalHeaderKey(header))
 		}
 	}
@@ -136,13 +452,13 @@ func DefaultHeadersWith(headers ...string) []string {
 
 // DefaultExposeHeadersWith returns a slice containing the headers you provided, along
 // with the default set of headers that are safely whitelisted for exposing. It does not
-//check for duplicate entries. See DefaultExposeHeaders for default headers value.
+// check for duplicate entries. See DefaultExposeHeaders for default headers value.
 func DefaultExposeHeadersWith(headers ...string) []string {
 	return append(DefaultExposedHeaders, headers...)
 }
 
 // AllowAllOrigins is a slice containing just the wildcard ("*") origin.
-var AllowAllOrigins = []*Match{EM("*")}
+var AllowAllOrigins = []OriginMatcher{EM("*")}
 
 // SpecSimpleMethods contains the HTTP methods that the CORS specification deems acceptable
 // methods for "simple" requests. We use these methods as the default if value is provided
@@ -170,7 +486,7 @@ var AllowAllHeaders = []string{"*"}
 // all CORS preflights / requests. It is used as the default list if you don't specify
 // anything.
 var DefaultAllowedHeaders = []string{
-	"Accept", "Content-Type", "Match", "X-Requested-With",
+	"Accept", "Content-Type", "Origin", "X-Requested-With",
 }
 
 // DefaultExposedHeaders is a slice containing the CORS-safelisted headers that
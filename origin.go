@@ -0,0 +1,371 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// OriginNull is the serialized value of an opaque origin. Browsers send it for requests
+// from sandboxed iframes, file:// urls, redirects across origins and the like.
+const OriginNull = "null"
+
+// Origin is the parsed and normalized form of an Origin header value. Origins are always
+// compared in this form so that values like https://API.example.com:443 and
+// https://api.example.com are treated as the same origin.
+type Origin struct {
+	// Scheme is the lowercase scheme of the origin (e.g. https).
+	Scheme string
+	// Host is the lowercase host of the origin. Internationalized domain names will be
+	// converted to their punycode form and IPv6 literals will not include the brackets.
+	Host string
+	// Port is the port of the origin. If the port was not specified, or it was the default
+	// port for the scheme, the value will be 0.
+	Port int
+	// Opaque will be true if the origin was the opaque "null" origin. None of the other
+	// fields will be set if Opaque is true.
+	Opaque bool
+	// serialized is the normalized string form of the origin.
+	serialized string
+}
+
+// defaultPorts contains the default port for each of the schemes we know about. If an
+// origin uses the default port we will drop it during normalization.
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+}
+
+// ParseOrigin parses and normalizes a serialized origin value (as sent in the Origin
+// header). Values that contain a path, query, fragment or userinfo component will be
+// rejected. A single trailing slash is tolerated. The opaque "null" origin is parsed into
+// an Origin where Opaque is true.
+func ParseOrigin(value string) (Origin, error) {
+	if value == OriginNull {
+		return Origin{Opaque: true, serialized: OriginNull}, nil
+	}
+	schemeEnd := strings.Index(value, "://")
+	if schemeEnd <= 0 {
+		return Origin{}, originError(value, "missing scheme")
+	}
+	scheme, err := parseScheme(value[:schemeEnd])
+	if err != nil {
+		return Origin{}, originError(value, err.Error())
+	}
+	rest := value[schemeEnd+3:]
+	if strings.HasSuffix(rest, "/") {
+		rest = rest[:len(rest)-1]
+	}
+	if strings.ContainsAny(rest, "/?#") {
+		return Origin{}, originError(value, "origins cannot contain a path, query or fragment")
+	}
+	if strings.ContainsRune(rest, '@') {
+		return Origin{}, originError(value, "origins cannot contain userinfo")
+	}
+
+	var hostPart, portPart string
+	isIPv6 := false
+	if strings.HasPrefix(rest, "[") {
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return Origin{}, originError(value, "unterminated IPv6 literal")
+		}
+		hostPart = rest[1:end]
+		isIPv6 = true
+		rest = rest[end+1:]
+		if rest != "" {
+			if rest[0] != ':' {
+				return Origin{}, originError(value, "unexpected characters after IPv6 literal")
+			}
+			portPart = rest[1:]
+			if portPart == "" {
+				return Origin{}, originError(value, "empty port")
+			}
+		}
+	} else if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		hostPart, portPart = rest[:i], rest[i+1:]
+		if portPart == "" {
+			return Origin{}, originError(value, "empty port")
+		}
+	} else {
+		hostPart = rest
+	}
+
+	var host string
+	if isIPv6 {
+		ip := net.ParseIP(hostPart)
+		if ip == nil || !strings.Contains(hostPart, ":") {
+			return Origin{}, originError(value, "invalid IPv6 literal")
+		}
+		host = ip.String()
+	} else {
+		host, err = normalizeHost(hostPart)
+		if err != nil {
+			return Origin{}, originError(value, err.Error())
+		}
+	}
+
+	port := 0
+	if portPart != "" {
+		port, err = parsePort(portPart)
+		if err != nil {
+			return Origin{}, originError(value, err.Error())
+		}
+		if defaultPorts[scheme] == port {
+			port = 0
+		}
+	}
+
+	origin := Origin{Scheme: scheme, Host: host, Port: port}
+	if rest == value[schemeEnd+3:] && scheme == value[:schemeEnd] && !isIPv6 && host == hostPart &&
+		(portPart == "" || (port != 0 && portPart[0] != '0')) {
+		// the value is already in its normalized form so we can reuse it (and avoid having
+		// to build a new string)
+		origin.serialized = value
+	} else {
+		origin.serialized = origin.serialize()
+	}
+	return origin, nil
+}
+
+// String returns the normalized serialized form of the origin.
+func (o Origin) String() string {
+	if o.serialized == "" {
+		return o.serialize()
+	}
+	return o.serialized
+}
+
+// IsIP returns true if the host of the origin is an IPv4 or IPv6 literal.
+func (o Origin) IsIP() bool {
+	return !o.Opaque && net.ParseIP(o.Host) != nil
+}
+
+// serialize builds the normalized string form of the origin.
+func (o Origin) serialize() string {
+	if o.Opaque {
+		return OriginNull
+	}
+	host := o.Host
+	if strings.ContainsRune(host, ':') {
+		host = "[" + host + "]"
+	}
+	if o.Port == 0 {
+		return o.Scheme + "://" + host
+	}
+	return o.Scheme + "://" + host + ":" + strconv.Itoa(o.Port)
+}
+
+// parseScheme validates and lowercases a scheme as defined by RFC 3986.
+func parseScheme(scheme string) (string, error) {
+	for i := 0; i < len(scheme); i++ {
+		b := scheme[i]
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z':
+		case i > 0 && (b >= '0' && b <= '9' || b == '+' || b == '-' || b == '.'):
+		default:
+			return "", errors.New("invalid scheme")
+		}
+	}
+	return strings.ToLower(scheme), nil
+}
+
+// parsePort validates a port value and converts it to an int.
+func parsePort(port string) (int, error) {
+	for i := 0; i < len(port); i++ {
+		if port[i] < '0' || port[i] > '9' {
+			return 0, errors.New("invalid port")
+		}
+	}
+	value, err := strconv.Atoi(port)
+	if err != nil || value < 1 || value > 65535 {
+		return 0, errors.New("port out of range")
+	}
+	return value, nil
+}
+
+// normalizeHost lowercases a host, converts any internationalized labels to punycode and
+// validates each label.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", errors.New("empty host")
+	}
+	if !isASCII(host) {
+		var err error
+		host, err = toASCIIHost(host)
+		if err != nil {
+			return "", err
+		}
+	}
+	host = strings.ToLower(host)
+	labelStart := 0
+	for i := 0; i <= len(host); i++ {
+		if i < len(host) && host[i] != '.' {
+			b := host[i]
+			if !(b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-' || b == '_') {
+				return "", errors.New("invalid character in host")
+			}
+			continue
+		}
+		labelLength := i - labelStart
+		if labelLength == 0 {
+			return "", errors.New("empty host label")
+		}
+		if labelLength > 63 {
+			return "", errors.New("host label too long")
+		}
+		labelStart = i + 1
+	}
+	return host, nil
+}
+
+// toASCIIHost converts an internationalized host name into its ASCII (punycode) form.
+// Only the label separators and case mappings needed for origin comparison are applied;
+// this is not a full implementation of the IDNA mapping tables.
+func toASCIIHost(host string) (string, error) {
+	host = strings.Map(func(r rune) rune {
+		switch r {
+		case '。', '．', '｡':
+			// ideographic + fullwidth full stops are label separators too
+			return '.'
+		}
+		return r
+	}, strings.ToLower(host))
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punycodeEncode(label)
+		if err != nil {
+			return "", err
+		}
+		labels[i] = "xn--" + encoded
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// isASCII returns true if the string only contains ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// originError creates the ValidationError returned when an origin cannot be parsed.
+func originError(value string, reason string) *ValidationError {
+	return &ValidationError{
+		Code:          OriginInvalid,
+		Message:       codedErrorMessages[OriginInvalid],
+		OriginalError: errors.New(strconv.Quote(value) + ": " + reason),
+	}
+}
+
+// punycode parameters as defined in RFC 3492.
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// punycodeEncode encodes a single label using the punycode algorithm from RFC 3492.
+func punycodeEncode(label string) (string, error) {
+	runes := []rune(label)
+	output := make([]byte, 0, len(label)*2)
+	for _, r := range runes {
+		if r < 0x80 {
+			output = append(output, byte(r))
+		}
+	}
+	basicCount := len(output)
+	handled := basicCount
+	if basicCount > 0 {
+		output = append(output, '-')
+	}
+	n := int32(punycodeInitialN)
+	delta := int32(0)
+	bias := int32(punycodeInitialBias)
+	for handled < len(runes) {
+		// find the smallest code point that we haven't handled yet
+		m := int32(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int64(delta)+int64(m-n)*int64(handled+1) > 0x7fffffff {
+			return "", errors.New("punycode overflow")
+		}
+		delta += (m - n) * int32(handled+1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := int32(punycodeBase); ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				output = append(output, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			output = append(output, punycodeDigit(q))
+			bias = punycodeAdapt(delta, int32(handled+1), handled == basicCount)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(output), nil
+}
+
+// punycodeAdapt is the bias adaptation function from RFC 3492.
+func punycodeAdapt(delta int32, numPoints int32, firstTime bool) int32 {
+	if firstTime {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := int32(0)
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+// punycodeDigit converts a punycode digit value into its ASCII representation.
+func punycodeDigit(digit int32) byte {
+	if digit < 26 {
+		return byte('a' + digit)
+	}
+	return byte('0' + digit - 26)
+}
@@ -0,0 +1,273 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Policy is the common interface for all of the types that can validate CORS requests. It
+// is implemented by *CORS, *Reloadable, *PolicySet and *TenantSelector so that they can be
+// used interchangeably (and nested).
+type Policy interface {
+	ValidatePreflight(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc)
+	ValidateRequest(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc)
+	ApplyActualResponseHeaders(w http.ResponseWriter, r *http.Request) *ValidationError
+	Handler(next http.Handler) http.Handler
+	// policyFor returns the CORS instance that should be used for the request (or nil if
+	// there is no matching policy) along with the request that should be passed to it.
+	// The request may be a copy with extra context values (e.g. the selected tenant).
+	policyFor(r *http.Request) (*CORS, *http.Request)
+}
+
+// PolicySet maps request paths (and optionally methods) to policies. It allows you to use
+// completely different CORS rules for different parts of your application. Patterns use
+// the same syntax as the Go 1.22 http.ServeMux (without host matching):
+//
+//	/api/               matches /api/ and everything under it
+//	/api/{id}           matches /api/ followed by a single path segment
+//	/files/{path...}    matches /files/ followed by anything
+//	/api/{$}            matches /api/ only
+//	GET /api/widgets    matches GET (and HEAD) requests for /api/widgets only
+//
+// When more than one pattern matches, the longest (most specific) pattern wins. For
+// preflight requests, the method from the Access-Control-Request-Method header is used
+// when matching method constraints. If no pattern matches, the default policy is used.
+// PolicySet is safe for concurrent use.
+type PolicySet struct {
+	defaultPolicy Policy
+	mu            sync.RWMutex
+	routes        []*policyRoute
+}
+
+// policyRoute is a pattern + policy registered with a PolicySet.
+type policyRoute struct {
+	pattern       string
+	method        string
+	segments      []routeSegment
+	prefix        bool
+	literalLength int
+	policy        Policy
+}
+
+// routeSegment is a single segment of a route pattern.
+type routeSegment struct {
+	literal  string
+	wildcard bool
+	rest     bool
+}
+
+// NewPolicySet creates a new PolicySet. defaultPolicy is used whenever none of the patterns
+// match. It can be nil, in which case requests that don't match will fail validation with
+// the PolicyNotFound code (or be passed straight through by Handler).
+func NewPolicySet(defaultPolicy Policy) *PolicySet {
+	return &PolicySet{defaultPolicy: defaultPolicy}
+}
+
+// Handle registers the policy for the pattern. An error will be returned if the pattern is
+// invalid or it has already been registered.
+func (ps *PolicySet) Handle(pattern string, policy Policy) error {
+	route, err := parseRoutePattern(pattern)
+	if err != nil {
+		return &ValidationError{
+			Code:          ConfigurationInvalid,
+			Message:       "the policy pattern " + pattern + " is invalid",
+			OriginalError: err,
+		}
+	}
+	route.policy = policy
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, existing := range ps.routes {
+		if existing.pattern == route.pattern {
+			return &ValidationError{
+				Code:    ConfigurationInvalid,
+				Message: "the policy pattern " + pattern + " has already been registered",
+			}
+		}
+	}
+	ps.routes = append(ps.routes, route)
+	return nil
+}
+
+// Lookup returns the policy that will be used for the request along with the pattern that
+// matched. If the default policy is used, the pattern will be empty. If there is no
+// matching policy, the policy will be nil.
+func (ps *PolicySet) Lookup(r *http.Request) (Policy, string) {
+	method := r.Method
+	if IsPreflightRequest(r) {
+		method = strings.ToUpper(r.Header.Get(HeaderKeyAccCtlReqMethod))
+	}
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	var best *policyRoute
+	for _, route := range ps.routes {
+		if route.matches(method, r.URL.Path) && (best == nil || route.moreSpecificThan(best)) {
+			best = route
+		}
+	}
+	if best == nil {
+		return ps.defaultPolicy, ""
+	}
+	return best.policy, best.pattern
+}
+
+// ValidatePreflight executes ValidatePreflight using the matching policy.
+func (ps *PolicySet) ValidatePreflight(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	if c, r := ps.policyFor(r); c != nil {
+		c.ValidatePreflight(w, r, handler)
+		return
+	}
+	handler(w, r, preflightError(PolicyNotFound))
+}
+
+// ValidateRequest executes ValidateRequest using the matching policy.
+func (ps *PolicySet) ValidateRequest(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	handler(w, r, ps.ApplyActualResponseHeaders(w, r))
+}
+
+// ApplyActualResponseHeaders executes ApplyActualResponseHeaders using the matching policy.
+func (ps *PolicySet) ApplyActualResponseHeaders(w http.ResponseWriter, r *http.Request) *ValidationError {
+	if c, r := ps.policyFor(r); c != nil {
+		return c.ApplyActualResponseHeaders(w, r)
+	}
+	return preflightError(PolicyNotFound)
+}
+
+// Handler is the same as CORS.Handler except that it uses the matching policy for each
+// request. Requests that don't match any policy are passed straight through to next.
+func (ps *PolicySet) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, r := ps.policyFor(r); c != nil {
+			c.serveHTTP(w, r, next)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandlerFunc is the same as Handler, but for http.HandlerFunc values.
+func (ps *PolicySet) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return ps.Handler(next).ServeHTTP
+}
+
+// policyFor implements the Policy interface.
+func (ps *PolicySet) policyFor(r *http.Request) (*CORS, *http.Request) {
+	policy, _ := ps.Lookup(r)
+	if policy == nil {
+		return nil, r
+	}
+	return policy.policyFor(r)
+}
+
+// parseRoutePattern parses a ServeMux style pattern.
+func parseRoutePattern(pattern string) (*policyRoute, error) {
+	route := &policyRoute{pattern: pattern}
+	path := strings.TrimSpace(pattern)
+	if i := strings.IndexAny(path, " \t"); i >= 0 {
+		route.method = strings.ToUpper(path[:i])
+		path = strings.TrimSpace(path[i+1:])
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, errors.New("patterns must start with a '/'")
+	}
+	path = path[1:]
+	if path == "" || strings.HasSuffix(path, "/") {
+		route.prefix = true
+		path = strings.TrimSuffix(path, "/")
+	}
+	if path == "" {
+		return route, nil
+	}
+	names := map[string]bool{}
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		segment := routeSegment{literal: part}
+		switch {
+		case part == "":
+			return nil, errors.New("patterns cannot contain empty segments")
+		case part == "{$}":
+			if i != len(parts)-1 || route.prefix {
+				return nil, errors.New("{$} must be the last segment")
+			}
+			// {$} means the path must end with a trailing slash
+			segment.literal = ""
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := part[1 : len(part)-1]
+			if strings.HasSuffix(name, "...") {
+				if i != len(parts)-1 || route.prefix {
+					return nil, errors.New("{" + name + "} must be the last segment")
+				}
+				name = strings.TrimSuffix(name, "...")
+				segment.rest = true
+			}
+			if name == "" || names[name] {
+				return nil, errors.New("wildcards must have unique names")
+			}
+			names[name] = true
+			segment.literal = ""
+			segment.wildcard = true
+		case strings.ContainsAny(part, "{}"):
+			return nil, errors.New("wildcards must be an entire segment")
+		default:
+			route.literalLength += len(part)
+		}
+		route.literalLength++
+		route.segments = append(route.segments, segment)
+	}
+	return route, nil
+}
+
+// matches returns true if the route matches the method + path.
+func (pr *policyRoute) matches(method string, path string) bool {
+	if pr.method != "" && pr.method != method && !(pr.method == http.MethodGet && method == http.MethodHead) {
+		return false
+	}
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	parts := strings.Split(path[1:], "/")
+	for i, segment := range pr.segments {
+		if i >= len(parts) {
+			return false
+		}
+		if segment.rest {
+			// like ServeMux, the rest can be empty but the slash before it can't be missing
+			// (e.g. /files/{path...} matches /files/ but not /files)
+			return true
+		}
+		if segment.wildcard {
+			if parts[i] == "" {
+				return false
+			}
+		} else if segment.literal != parts[i] {
+			return false
+		}
+	}
+	if pr.prefix {
+		// the path must continue past the end of the pattern (e.g. /api/ but not /api)
+		return len(parts) > len(pr.segments)
+	}
+	return len(parts) == len(pr.segments)
+}
+
+// moreSpecificThan returns true if the route should take precedence over other.
+func (pr *policyRoute) moreSpecificThan(other *policyRoute) bool {
+	if pr.literalLength != other.literalLength {
+		return pr.literalLength > other.literalLength
+	}
+	if pr.prefix != other.prefix {
+		return !pr.prefix
+	}
+	if len(pr.segments) != len(other.segments) {
+		return len(pr.segments) > len(other.segments)
+	}
+	return pr.method != "" && other.method == ""
+}
@@ -0,0 +1,132 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPolicySetLookup(t *testing.T) {
+	ps := cors.NewPolicySet(mustCORS(t, "https://public.com"))
+	patterns := []string{
+		"/api/",
+		"/api/admin/",
+		"/api/{id}",
+		"/api/special",
+		"/files/{path...}",
+		"/docs/{$}",
+		"POST /webhooks/{provider}",
+	}
+	for _, pattern := range patterns {
+		if err := ps.Handle(pattern, mustCORS(t, "https://theyakka.com")); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodGet, "/", ""},
+		{http.MethodGet, "/api", ""},
+		{http.MethodGet, "/api/", "/api/"},
+		{http.MethodGet, "/api/widgets/1", "/api/"},
+		{http.MethodGet, "/api/admin/users", "/api/admin/"},
+		{http.MethodGet, "/api/123", "/api/{id}"},
+		{http.MethodGet, "/api/special", "/api/special"},
+		{http.MethodGet, "/files", ""},
+		{http.MethodGet, "/files/", "/files/{path...}"},
+		{http.MethodGet, "/files/a/b/c.txt", "/files/{path...}"},
+		{http.MethodGet, "/docs/", "/docs/{$}"},
+		{http.MethodGet, "/docs/intro", ""},
+		{http.MethodPost, "/webhooks/github", "POST /webhooks/{provider}"},
+		{http.MethodGet, "/webhooks/github", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if _, pattern := ps.Lookup(r); pattern != test.expected {
+			t.Errorf("%s %s: expected '%s' but got '%s'", test.method, test.path, test.expected, pattern)
+		}
+	}
+}
+
+func TestPolicySetPreflightMethod(t *testing.T) {
+	ps := cors.NewPolicySet(nil)
+	_ = ps.Handle("POST /webhooks/{provider}", mustCORS(t, "https://theyakka.com"))
+	r := buildPreflightRequest("https://theyakka.com")
+	r.URL.Path = "/webhooks/github"
+	r.Header.Set(cors.HeaderKeyAccCtlReqMethod, http.MethodPost)
+	if _, pattern := ps.Lookup(r); pattern != "POST /webhooks/{provider}" {
+		t.Error("expected the preflight to match using the requested method")
+	}
+	r.Header.Set(cors.HeaderKeyAccCtlReqMethod, http.MethodPut)
+	ps.ValidatePreflight(httptest.NewRecorder(), r, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.PolicyNotFound {
+			t.Error("expected the preflight to fail because there is no policy")
+		}
+	})
+}
+
+func TestPolicySetHandler(t *testing.T) {
+	ps := cors.NewPolicySet(mustCORS(t, "https://public.com"))
+	admin, err := cors.NewReloadable(&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://admin.theyakka.com")},
+	}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	_ = ps.Handle("/admin/", admin)
+	handler := ps.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(origin string, path string) string {
+		r := buildActualRequest(http.MethodGet, origin)
+		r.URL.Path = path
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin)
+	}
+	if serve("https://public.com", "/") != "https://public.com" {
+		t.Error("expected the default policy to be used")
+	}
+	if serve("https://public.com", "/admin/users") != "" {
+		t.Error("expected the admin policy to be used")
+	}
+	if serve("https://admin.theyakka.com", "/admin/users") != "https://admin.theyakka.com" {
+		t.Error("expected the admin policy to be used")
+	}
+}
+
+func TestPolicySetInvalidPatterns(t *testing.T) {
+	ps := cors.NewPolicySet(nil)
+	invalid := []string{"api", "/api//x", "/{id}/{id}", "/{path...}/x", "/a{b}", "/{$}/x"}
+	for _, pattern := range invalid {
+		if err := ps.Handle(pattern, mustCORS(t, "https://theyakka.com")); err == nil {
+			t.Errorf("expected the pattern '%s' to be invalid", pattern)
+		}
+	}
+	_ = ps.Handle("/api/", mustCORS(t, "https://theyakka.com"))
+	if err := ps.Handle("/api/", mustCORS(t, "https://theyakka.com")); err == nil {
+		t.Error("expected duplicate patterns to be rejected")
+	}
+}
+
+func mustCORS(t *testing.T, origins ...string) *cors.CORS {
+	matchers := make([]cors.OriginMatcher, 0, len(origins))
+	for _, origin := range origins {
+		matchers = append(matchers, cors.EM(origin))
+	}
+	c, err := (&cors.Options{AllowedOrigins: matchers}).NewCORS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -7,21 +7,25 @@
 package cors
 
 import (
+	"context"
 	"net/http"
-	"strconv"
 	"strings"
+	"time"
 )
 
 const (
 	// HeaderKeyReqOrigin is the http header for the request origin
-	HeaderKeyReqOrigin string = "Match"
+	HeaderKeyReqOrigin string = "Origin"
 	// HeaderKeyAccCtlReqMethod is the http header designating the CORS response allowed method
 	HeaderKeyAccCtlReqMethod = "Access-Control-Request-Method"
 	// HeaderKeyAccCtlReqHeaders is the http header designating the CORS response allowed headers
 	HeaderKeyAccCtlReqHeaders = "Access-Control-Request-Headers"
+	// HeaderKeyAccCtlReqPrivateNetwork is the http header designating that the preflight is
+	// requesting access to a private network
+	HeaderKeyAccCtlReqPrivateNetwork = "Access-Control-Request-Private-Network"
 
 	// HeaderKeyAccCtlResAllowOrigin is the http header designating the CORS response allowed origin
-	HeaderKeyAccCtlResAllowOrigin = "Access-Control-Allow-Match"
+	HeaderKeyAccCtlResAllowOrigin = "Access-Control-Allow-Origin"
 	// HeaderKeyAccCtlResAllowMethods is the http header designating the CORS response allowed methods
 	HeaderKeyAccCtlResAllowMethods = "Access-Control-Allow-Methods"
 	// HeaderKeyAccCtlResAllowHeaders is the http header designating the CORS response allowed headers
@@ -33,6 +37,9 @@ const (
 	// HeaderKeyAccCtlResAllowCreds is the http header designating whether the CORS response allows
 	// cookies / credentials
 	HeaderKeyAccCtlResAllowCreds = "Access-Control-Allow-Credentials"
+	// HeaderKeyAccCtlResAllowPrivateNetwork is the http header designating whether the CORS
+	// response allows access to a private network
+	HeaderKeyAccCtlResAllowPrivateNetwork = "Access-Control-Allow-Private-Network"
 )
 
 // PreflightHandlerFunc will be excuted when the preflight has completed. If it succeeds,
@@ -44,90 +51,183 @@ type PreflightHandlerFunc func(w http.ResponseWriter, r *http.Request, error *Va
 // fully executed, the handler will be executed so that you can check the response.
 func (c *CORS) ValidatePreflight(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
 	headers := w.Header()
+	var start time.Time
+	if c.observing {
+		start = time.Now()
+	}
+	ctx, span := c.startSpan(r.Context(), SpanPreflight)
 	// if the http method is not OPTIONS then we're going to fail because the preflight
 	// should be delivered via OPTIONS. We return an error code indicating that it
 	// wasn't options so that you can forward on the request if you choose.
 	if r.Method != http.MethodOptions {
-		handler(w, r, preflightError(PreflightErrMethodInvalid))
+		err := preflightError(PreflightErrMethodInvalid)
+		if span != nil {
+			c.endDecisionSpan(span, r, err, false)
+		}
+		if c.observing {
+			c.observeDecision(r, DecisionPreflight, err, nil, false, start)
+		}
+		handler(w, r, err)
 		return
 	}
 
 	// ensure that we don't poison any cache or force a cache to return the wrong value
-	headers.Add("Vary", HeaderKeyReqOrigin)
-	headers.Add("Vary", HeaderKeyAccCtlReqMethod)
-	headers.Add("Vary", HeaderKeyAccCtlReqHeaders)
+	addVary(headers, c.preflightVary)
+
+	var result preflightResult
+	cached := false
+	if c.preflightCache == nil {
+		result = c.evaluatePreflight(ctx, r)
+	} else if key, ok := newPreflightKey(r); !ok {
+		result = c.evaluatePreflight(ctx, r)
+	} else if result, cached = c.preflightCache.get(key); !cached {
+		result = c.evaluatePreflight(ctx, r)
+		if result.cacheable {
+			c.preflightCache.add(key, result)
+		}
+	}
+	result.apply(c, headers)
+	if span != nil {
+		c.endDecisionSpan(span, r, result.err, cached)
+	}
+	if c.observing {
+		c.observeDecision(r, DecisionPreflight, result.err, result.rule, cached, start)
+	}
+	handler(w, r, result.err)
+}
+
+// preflightResult is the outcome of a preflight evaluation. It contains the error (if the
+// preflight failed) and the response header values that were determined before the
+// evaluation finished.
+type preflightResult struct {
+	err            *ValidationError
+	allowOrigin    []string
+	allowMethods   []string
+	allowHeaders   []string
+	privateNetwork bool
+	// rule is the AllowedOrigins value that matched the origin (if any)
+	rule OriginMatcher
+	// cacheable will be true if the result can be stored in the preflight cache
+	cacheable bool
+}
+
+// apply sets the response headers for the result.
+func (pr *preflightResult) apply(c *CORS, headers http.Header) {
+	if pr.allowOrigin != nil {
+		headers[HeaderKeyAccCtlResAllowOrigin] = pr.allowOrigin
+	}
+	if pr.allowMethods != nil {
+		headers[HeaderKeyAccCtlResAllowMethods] = pr.allowMethods
+	}
+	if pr.allowHeaders != nil {
+		headers[HeaderKeyAccCtlResAllowHeaders] = pr.allowHeaders
+	}
+	if pr.privateNetwork {
+		headers[HeaderKeyAccCtlResAllowPrivateNetwork] = headerValueTrue
+	}
+	if pr.err != nil {
+		return
+	}
+	// pass through the max age header
+	if c.maxAgeValue != nil {
+		headers[HeaderKeyAccResCtlMaxAge] = c.maxAgeValue
+	}
+	// pass through the allow credentials header
+	if c.options.AllowCredentials {
+		headers[HeaderKeyAccCtlResAllowCreds] = headerValueTrue
+	}
+}
+
+// evaluatePreflight does the work for ValidatePreflight. The header values in the result
+// may re-use the request header values. ctx is the request context (including the preflight
+// span if tracing is enabled).
+func (c *CORS) evaluatePreflight(ctx context.Context, r *http.Request) preflightResult {
+	result := preflightResult{cacheable: true}
 
 	// check the origin
-	if c.areAllOriginsAllowed {
+	origin := firstValue(r.Header[HeaderKeyReqOrigin])
+	if c.areAllOriginsAllowed && !c.reflectOrigin {
 		// all origins are allowed, set header
-		headers.Set(HeaderKeyAccCtlResAllowOrigin, "*")
+		result.allowOrigin = headerValueAll
 	} else {
-		origin := r.Header.Get(HeaderKeyReqOrigin)
-		if c.IsOriginAllowed(origin) {
-			// passed origin is allowed, set header
-			headers.Set(HeaderKeyAccCtlResAllowOrigin, origin)
-		} else {
-			// the origin wasn't whitelisted
-			handler(w, r, preflightError(PreflightErrOriginNotAllowed))
-			return
+		err, rule, cacheable := c.validateOrigin(ctx, r, origin, PreflightErrOriginNotAllowed)
+		result.rule = rule
+		result.cacheable = cacheable
+		if err != nil {
+			// the origin wasn't whitelisted (or wasn't a valid origin)
+			result.err = err
+			return result
 		}
+		// passed origin is allowed, set header (re-using the request value)
+		result.allowOrigin = r.Header[HeaderKeyReqOrigin][:1:1]
 	}
 
 	// check the requested method
-	method := r.Header.Get(HeaderKeyAccCtlReqMethod)
+	method := firstValue(r.Header[HeaderKeyAccCtlReqMethod])
 	if method == "" {
 		// the method header was missing
-		handler(w, r, preflightError(PreflightErrMethodMissing))
-		return
+		result.err = preflightError(PreflightErrMethodMissing)
+		return result
 	}
-	// when we compare the method we should convert to uppercase before doing the check
-	upperMethod := strings.ToUpper(method)
-	if c.IsMethodAllowed(upperMethod) {
-		// we only return the method that was requested here.
-		headers.Set(HeaderKeyAccCtlResAllowMethods, upperMethod)
-	} else {
+	// the method values include the uppercase and lowercase forms of each method so we only
+	// need to convert mixed case values to uppercase before doing the check
+	methodValue, ok := c.methodValues[method]
+	if !ok {
+		methodValue, ok = c.methodValues[strings.ToUpper(method)]
+	}
+	if !ok {
 		// the method wasn't whitelisted
-		handler(w, r, preflightError(PreflightErrMethodNotAllowed))
-		return
+		result.err = preflightError(PreflightErrMethodNotAllowed)
+		return result
 	}
+	// we only return the method that was requested here.
+	result.allowMethods = methodValue
 	// if all headers are allowed, then we should skip the check because we will need to parse the
 	// header value first and that will consume time + resources
 	if !c.areAllHeadersAllowed {
-		// parse the header string and then check to see if the headers have been whitelisted
-		headersString := r.Header.Get(HeaderKeyAccCtlReqHeaders)
-		cleanedHeaders := parseHeaderList(headersString)
-		if !c.AreHeadersAllowed(cleanedHeaders) {
+		// check to see if each of the requested headers has been whitelisted
+		requestedHeaders := r.Header[HeaderKeyAccCtlReqHeaders]
+		_, span := c.startSpan(ctx, SpanHeaderValidation)
+		allowed := c.areHeaderListsAllowed(requestedHeaders)
+		if span != nil {
+			span.SetAttribute("headers", strings.Join(requestedHeaders, ", "))
+			span.SetAttribute("allowed", allowed)
+			span.End()
+		}
+		if !allowed {
 			// one or more of the headers weren't whitelisted
-			handler(w, r, preflightError(PreflightErrHeadersNotAllowed))
-			return
+			result.err = preflightError(PreflightErrHeadersNotAllowed)
+			return result
 		}
-		if len(cleanedHeaders) > 0 {
-			headers.Set(HeaderKeyAccCtlResAllowHeaders, strings.Join(cleanedHeaders, ", "))
+		if len(requestedHeaders) > 0 {
+			// all of the headers were allowed so we can just echo the request value
+			result.allowHeaders = requestedHeaders[:len(requestedHeaders):len(requestedHeaders)]
 		}
 	}
 
-	if len(c.exposedHeaders) > 0 {
-
-	}
-
-	// pass through the max age header
-	if c.options.MaxAge > 0 {
-		headers.Set(HeaderKeyAccResCtlMaxAge, strconv.Itoa(c.options.MaxAge))
-	}
-
-	// pass through the allow credentials header
-	if c.options.AllowCredentials {
-		headers.Set(HeaderKeyAccCtlResAllowCreds, "true")
+	// check to see if private network access was requested (and whether it is allowed)
+	if firstValue(r.Header[HeaderKeyAccCtlReqPrivateNetwork]) == "true" {
+		if c.privateNetworkOrigins != nil && c.privateNetworkOrigins.dynamic {
+			result.cacheable = false
+		}
+		if !c.isPrivateNetworkAllowed(origin) {
+			// private network access wasn't allowed for this origin
+			result.err = preflightError(PreflightErrPrivateNetworkNotAllowed)
+			return result
+		}
+		result.privateNetwork = true
 	}
-
-	handler(w, r, nil)
+	return result
 }
 
-func preflightError(code int) *ValidationError {
+// preflightError creates a new ValidationError for the code. Errors are never shared
+// between requests (the fields are exported so handlers are free to modify them) so this is
+// only called once a request has been rejected.
+func preflightError(code Code) *ValidationError {
 	return preflightErrorWithSource(code, nil)
 }
 
-func preflightErrorWithSource(code int, originalError error) *ValidationError {
+func preflightErrorWithSource(code Code, originalError error) *ValidationError {
 	message := codedErrorMessages[code]
 	if message == "" {
 		message = "please check code + original error for details"
@@ -140,22 +240,139 @@ func preflightErrorWithSource(code int, originalError error) *ValidationError {
 }
 
 // IsOriginAllowed does a check to see if an origin value is whitelisted according to the
-// attached AllowedOrigins values.
+// attached AllowedOrigins values. The origin will be parsed and normalized before it is
+// checked. Invalid origins are never allowed (unless all origins are allowed). Note that
+// the AllowOriginFunc is not consulted because it requires the request.
 func (c *CORS) IsOriginAllowed(checkOrigin string) bool {
 	// check first to see if all origins are allowed so we can get the heck out of here
 	if c.areAllOriginsAllowed {
 		return true
 	}
-	checkOrigin = strings.ToLower(checkOrigin)
+	origin, err := ParseOrigin(checkOrigin)
+	if err != nil {
+		return false
+	}
 	// check each of the allowed origin values to see if we have a match
-	for _, origin := range c.allowedOrigins {
-		if origin.Matches(checkOrigin) {
-			// allowed
-			return true
+	return c.allowedOrigins != nil && c.allowedOrigins.matches(origin)
+}
+
+// MatchingRule returns the first of the AllowedOrigins values (in declaration order) that
+// matches the origin. It can be used to report why an origin was allowed. If all origins
+// are allowed, or none of the values match, false will be returned.
+func (c *CORS) MatchingRule(checkOrigin string) (OriginMatcher, bool) {
+	if c.allowedOrigins == nil {
+		return nil, false
+	}
+	origin, err := ParseOrigin(checkOrigin)
+	if err != nil {
+		return nil, false
+	}
+	i := c.allowedOrigins.match(origin)
+	if i < 0 {
+		return nil, false
+	}
+	return c.allowedOrigins.rule(i), true
+}
+
+// validateOrigin checks the request origin against the AllowedOrigins values and then, if
+// none of them matched, the AllowOriginFunc and the OriginStore. If the origin is not
+// allowed, a ValidationError using the notAllowedCode will be returned. If the
+// AllowOriginFunc or OriginStore fails, the error will be wrapped in a ValidationError
+// with the OriginLookupFailed code (unless the store is configured to fail open). If one
+// of the AllowedOrigins values matched, it will be returned as the rule. The returned bool
+// will be true if the decision can be stored in the preflight cache. ctx is passed to the
+// AllowOriginFunc and the OriginStore (it will contain the lookup span if tracing is
+// enabled).
+func (c *CORS) validateOrigin(ctx context.Context, r *http.Request, checkOrigin string, notAllowedCode Code) (*ValidationError, OriginMatcher, bool) {
+	if c.areAllOriginsAllowed && !c.reflectOrigin {
+		return nil, nil, true
+	}
+	origin, err := ParseOrigin(checkOrigin)
+	if err != nil {
+		return preflightErrorWithSource(notAllowedCode, err), nil, false
+	}
+	if c.areAllOriginsAllowed {
+		// any valid origin can be reflected, except for the opaque null origin. every
+		// sandboxed iframe and local file sends it, so it has to be allowed explicitly.
+		if origin.Opaque {
+			return preflightError(notAllowedCode), nil, true
 		}
+		return nil, nil, true
 	}
-	// not allowed. sorry.
-	return false
+	// a rejection can only be cached if every rule that was consulted is cacheable
+	cacheable := true
+	if c.allowedOrigins != nil {
+		_, span := c.startSpan(ctx, SpanOriginMatch)
+		i := c.allowedOrigins.match(origin)
+		if span != nil {
+			span.SetAttribute("origin", checkOrigin)
+			span.SetAttribute("matched", i >= 0)
+			if i >= 0 {
+				span.SetAttribute("rule", c.allowedOrigins.rule(i).String())
+			}
+			span.End()
+		}
+		if i >= 0 {
+			rule := c.allowedOrigins.rule(i)
+			return nil, rule, isCacheableMatcher(rule)
+		}
+		cacheable = !c.allowedOrigins.dynamic
+	}
+	if c.options.AllowOriginFunc != nil {
+		lookupCtx, span := c.startSpan(ctx, SpanAllowOriginFunc)
+		allowed, err := c.options.AllowOriginFunc(lookupCtx, r, origin.String())
+		if span != nil {
+			endLookupSpan(span, allowed, err)
+		}
+		if err != nil {
+			return preflightErrorWithSource(OriginLookupFailed, err), nil, false
+		}
+		if allowed {
+			return nil, nil, c.options.PreflightCacheAllowOriginFunc
+		}
+		cacheable = cacheable && c.options.PreflightCacheAllowOriginFunc
+	}
+	if c.originStore != nil {
+		lookupCtx, span := c.startSpan(ctx, SpanOriginStore)
+		allowed, err := c.originStore.LookupOrigin(lookupCtx, origin.String())
+		if span != nil {
+			endLookupSpan(span, allowed, err)
+		}
+		if err != nil {
+			if c.options.OriginStoreFailOpen {
+				return nil, nil, false
+			}
+			return preflightErrorWithSource(OriginLookupFailed, err), nil, false
+		}
+		if allowed {
+			return nil, nil, c.options.PreflightCacheOriginStore
+		}
+		cacheable = cacheable && c.options.PreflightCacheOriginStore
+	}
+	return preflightError(notAllowedCode), nil, cacheable
+}
+
+// IsPrivateNetworkAllowed will return true if private network access has been enabled and
+// the origin is allowed to access the private network. If PrivateNetworkOrigins is empty
+// then all allowed origins will be able to access the private network.
+func (c *CORS) IsPrivateNetworkAllowed(checkOrigin string) bool {
+	return c.IsOriginAllowed(checkOrigin) && c.isPrivateNetworkAllowed(checkOrigin)
+}
+
+// isPrivateNetworkAllowed does the work for IsPrivateNetworkAllowed, but assumes that the
+// origin has already been validated.
+func (c *CORS) isPrivateNetworkAllowed(checkOrigin string) bool {
+	if !c.options.AllowPrivateNetwork {
+		return false
+	}
+	if c.privateNetworkOrigins == nil {
+		return true
+	}
+	origin, err := ParseOrigin(checkOrigin)
+	if err != nil {
+		return false
+	}
+	return c.privateNetworkOrigins.matches(origin)
 }
 
 // IsMethodAllowed will return true if the provided method value is in the list of
@@ -166,87 +383,23 @@ func (c *CORS) IsMethodAllowed(checkMethod string) bool {
 		return true
 	}
 	// check to see if the method that was passed is in the list of allowed methods
-	for _, method := range c.allowedMethods {
-		if method == checkMethod {
-			return true
-		}
+	if _, ok := c.methodValues[checkMethod]; ok {
+		return true
 	}
 	// not allowed. dun dun duuunnnn.
 	return false
 }
 
+// AreHeadersAllowed will return true if all of the headers are in the list of whitelisted
+// headers. The comparison is case-insensitive.
 func (c *CORS) AreHeadersAllowed(headers []string) bool {
-	for _, passedHeader := range headers {
-		isAllowed := false
-		for _, allowedHeader := range c.allowedHeaders {
-			if passedHeader == allowedHeader {
-				isAllowed = true
-				break
-			}
-		}
-		if !isAllowed {
+	if c.areAllHeadersAllowed {
+		return true
+	}
+	for _, header := range headers {
+		if !c.isHeaderAllowed(header) {
 			return false
 		}
 	}
-	// not allowed
 	return true
 }
-
-func cleanAllowedHeaderValue(value string) []string {
-	//var headers []string
-	//splitValues := strings.Split(value, ",")
-	//for _, splitValue := range splitValues {
-	//	trimmed := strings.TrimLeft(splitValue, " ")
-	//	headers = append(headers, http.CanonicalHeaderKey(trimmed))
-	//}
-	//return headers
-	return []string{}
-}
-
-const toLower = 'a' - 'A'
-
-// parseHeaderList tokenize + normalize a string containing a list of headers
-func parseHeaderList(headerList string) []string {
-	l := len(headerList)
-	h := make([]byte, 0, l)
-	upper := true
-	// Estimate the number headers in order to allocate the right splice size
-	t := 0
-	for i := 0; i < l; i++ {
-		if headerList[i] == ',' {
-			t++
-		}
-	}
-	headers := make([]string, 0, t)
-	for i := 0; i < l; i++ {
-		b := headerList[i]
-		switch {
-		case b >= 'a' && b <= 'z':
-			if upper {
-				h = append(h, b-toLower)
-			} else {
-				h = append(h, b)
-			}
-		case b >= 'A' && b <= 'Z':
-			if !upper {
-				h = append(h, b+toLower)
-			} else {
-				h = append(h, b)
-			}
-		case b == '-' || b == '_' || (b >= '0' && b <= '9'):
-			h = append(h, b)
-		}
-
-		if b == ' ' || b == ',' || i == l-1 {
-			if len(h) > 0 {
-				// Flush the found header
-				headers = append(headers, string(h))
-				h = h[:0]
-				upper = true
-			}
-		} else {
-			upper = b == '-' || b == '_'
-		}
-	}
-	return headers
-}
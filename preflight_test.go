@@ -7,16 +7,18 @@
 package cors_test
 
 import (
+	"fmt"
 	"github.com/theyakka/cors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
 func TestValidPreflight(t *testing.T) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://.*\.theyakka\.com`), cors.WC(`https?://theyakka\.com`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://.*\.theyakka\.com`), cors.RX(`https?://theyakka\.com`),
 		},
 		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
 	}
@@ -38,8 +40,8 @@ func TestValidPreflight(t *testing.T) {
 
 func TestValidPreflightResponse(t *testing.T) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://.*\.theyakka\.com`), cors.WC(`https?://theyakka\.com`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://.*\.theyakka\.com`), cors.RX(`https?://theyakka\.com`),
 		},
 		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
 	}
@@ -68,8 +70,8 @@ func TestValidPreflightResponse(t *testing.T) {
 
 func TestInvalidOriginPreflight(t *testing.T) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://.*\.theyakka\.com`), cors.WC(`https?://theyakka\.com`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://.*\.theyakka\.com`), cors.RX(`https?://theyakka\.com`),
 		},
 		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
 	}
@@ -95,8 +97,8 @@ func TestInvalidOriginPreflight(t *testing.T) {
 
 func TestValidOriginPreflightWithPort(t *testing.T) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://localhost:8[0-9]{3}`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://localhost:8[0-9]{3}`),
 		},
 		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
 	}
@@ -116,58 +118,138 @@ func TestValidOriginPreflightWithPort(t *testing.T) {
 	})
 }
 
-func BenchmarkExactPreflight(b *testing.B) {
-	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.EM(`https://theyakka.com`),
-		},
-		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
-	}
-	c, err := o.NewCORS()
+func TestHeaderPatterns(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedHeaders: cors.DefaultHeadersWith("X-Acme-*", "x-*-trace", "Authorization"),
+	}).NewCORS()
 	if err != nil {
-		b.Error(err)
+		t.Error(err)
 		return
 	}
+	tests := []struct {
+		headers  []string
+		expected bool
+	}{
+		{[]string{"X-Acme-Tenant", "Content-Type"}, true},
+		{[]string{"x-acme-request-id"}, true},
+		{[]string{"X-Acme"}, false},
+		{[]string{"X-B3-Trace"}, true},
+		{[]string{"X-Trace"}, false},
+		{[]string{"X-Other"}, false},
+		{[]string{"authorization", "X-Acme-Tenant", "X-Other"}, false},
+	}
+	for _, test := range tests {
+		if c.AreHeadersAllowed(test.headers) != test.expected {
+			t.Errorf("%v: expected %v", test.headers, test.expected)
+		}
+	}
 
 	req := buildPreflightRequest("https://theyakka.com")
-	w := httptest.NewRecorder()
-	b.ReportAllocs()
-	b.ResetTimer()
-
-	for i := 0; i < b.N; i++ {
-		c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
-		})
-	}
+	req.Header.Set(cors.HeaderKeyAccCtlReqHeaders, "x-acme-tenant,x-b3-trace")
+	c.ValidatePreflight(httptest.NewRecorder(), req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error != nil {
+			t.Error(error)
+		}
+	})
 }
 
-func BenchmarkWildcardPreflight(b *testing.B) {
+func TestPreflightAllocations(t *testing.T) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://.*\.theyakka\.com`), cors.WC(`https?://theyakka\.com`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.EM("https://theyakka.com"), cors.WC("https://*.theyakka.com"),
 		},
-		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders:   cors.DefaultHeadersWith("Authorization"),
+		MaxAge:           600,
+		AllowCredentials: true,
 	}
 	c, err := o.NewCORS()
 	if err != nil {
-		b.Error(err)
+		t.Error(err)
 		return
 	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	expectations := []struct {
+		origin string
+		allocs float64
+	}{
+		{"https://theyakka.com", 0},
+		{"https://app.theyakka.com", 0},
+		// each rejection gets its own error
+		{"https://acme.com", 1},
+	}
+	for _, expectation := range expectations {
+		req := buildPreflightRequest(expectation.origin)
+		req.Header.Set(cors.HeaderKeyAccCtlReqMethod, http.MethodPut)
+		w := httptest.NewRecorder()
+		allocs := testing.AllocsPerRun(100, func() {
+			c.ValidatePreflight(w, req, handler)
+		})
+		if allocs != expectation.allocs {
+			t.Errorf("%s: expected %v allocations but got %v", expectation.origin, expectation.allocs, allocs)
+		}
+	}
+}
 
-	req := buildPreflightRequest("https://theyakka.com")
-	w := httptest.NewRecorder()
-	b.ReportAllocs()
-	b.ResetTimer()
+func BenchmarkExactPreflight(b *testing.B) {
+	for _, size := range []int{1, 100, 5000} {
+		origins := benchmarkOrigins(size-1, "https://customer-%d.example.com")
+		origins = append(origins, cors.EM(`https://theyakka.com`))
+		b.Run(fmt.Sprintf("origins=%d", size), func(b *testing.B) {
+			benchmarkPreflight(b, origins, "https://theyakka.com")
+		})
+	}
+}
 
-	for i := 0; i < b.N; i++ {
-		c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+func BenchmarkWildcardPreflight(b *testing.B) {
+	b.Run("pair", func(b *testing.B) {
+		benchmarkPreflight(b, []cors.OriginMatcher{
+			cors.RX(`https?://.*\.theyakka\.com`), cors.RX(`https?://theyakka\.com`),
+		}, "https://theyakka.com")
+	})
+	for _, size := range []int{1, 100, 5000} {
+		origins := make([]cors.OriginMatcher, 0, size)
+		for i := 0; i < size-1; i++ {
+			origins = append(origins, cors.RX(fmt.Sprintf(`https://[a-z]+\.customer-%d\.example\.com`, i)))
+		}
+		origins = append(origins, cors.RX(`https://[a-z]+\.theyakka\.com`))
+		b.Run(fmt.Sprintf("regex/origins=%d", size), func(b *testing.B) {
+			benchmarkPreflight(b, origins, "https://app.theyakka.com")
+		})
+	}
+	for _, size := range []int{1, 100, 5000} {
+		origins := benchmarkOrigins(size-1, "https://*.customer-%d.example.com")
+		origins = append(origins, cors.WC(`https://*.theyakka.com`))
+		b.Run(fmt.Sprintf("glob/origins=%d", size), func(b *testing.B) {
+			benchmarkPreflight(b, origins, "https://app.theyakka.com")
+		})
+	}
+	for _, size := range []int{1, 100, 5000} {
+		origins := make([]cors.OriginMatcher, 0, size)
+		for i := 0; i < size-1; i++ {
+			origins = append(origins, cors.DomainSuffix(fmt.Sprintf("customer-%d.example.com", i)))
+		}
+		origins = append(origins, cors.DomainSuffix("theyakka.com"))
+		b.Run(fmt.Sprintf("suffix/origins=%d", size), func(b *testing.B) {
+			benchmarkPreflight(b, origins, "https://app.theyakka.com")
+		})
+	}
+	// expressions without a literal suffix can't use the suffix automaton
+	for _, size := range []int{1, 100, 1000} {
+		origins := make([]cors.OriginMatcher, 0, size)
+		for i := 0; i < size; i++ {
+			origins = append(origins, cors.RX(fmt.Sprintf(`https://app-%d\.example\.(com|net)`, i)))
+		}
+		b.Run(fmt.Sprintf("regex-nosuffix/origins=%d", size), func(b *testing.B) {
+			benchmarkPreflight(b, origins, fmt.Sprintf("https://app-%d.example.net", size-1))
 		})
 	}
 }
 
 func BenchmarkWildcardPortPreflight(b *testing.B) {
 	o := cors.Options{
-		AllowedOrigins: []*cors.Match{
-			cors.WC(`https?://localhost:8[0-9]{3}`),
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://localhost:8[0-9]{3}`),
 		},
 		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
 	}
@@ -206,6 +288,158 @@ func TestAllowAllPreflight(t *testing.T) {
 	})
 }
 
+func TestPrivateNetworkPreflight(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.EM("https://theyakka.com"), cors.EM("https://api.theyakka.com"),
+		},
+		AllowedHeaders:        cors.DefaultHeadersWith("Authorization"),
+		AllowPrivateNetwork:   true,
+		PrivateNetworkOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildPreflightRequest("https://theyakka.com")
+	req.Header.Set(cors.HeaderKeyAccCtlReqPrivateNetwork, "true")
+	w := httptest.NewRecorder()
+	c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error != nil {
+			t.Error("expected no errors to have occurred")
+			return
+		}
+		if w.Header().Get(cors.HeaderKeyAccCtlResAllowPrivateNetwork) != "true" {
+			t.Error("expected the allow private network header to have been set")
+		}
+	})
+
+	req = buildPreflightRequest("https://api.theyakka.com")
+	req.Header.Set(cors.HeaderKeyAccCtlReqPrivateNetwork, "true")
+	w = httptest.NewRecorder()
+	c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.PreflightErrPrivateNetworkNotAllowed {
+			t.Error("expected error code to indicate private network access wasn't allowed")
+		}
+	})
+}
+
+func TestPrivateNetworkPreflightDisabled(t *testing.T) {
+	c, err := cors.AllowAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildPreflightRequest("https://theyakka.com")
+	req.Header.Set(cors.HeaderKeyAccCtlReqPrivateNetwork, "true")
+	w := httptest.NewRecorder()
+	c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.PreflightErrPrivateNetworkNotAllowed {
+			t.Error("expected error code to indicate private network access wasn't allowed")
+		}
+	})
+}
+
+func TestReflectOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		options cors.Options
+	}{
+		{"allowed origins", cors.Options{
+			AllowedOrigins: []cors.OriginMatcher{cors.WC("https://*.theyakka.com")},
+		}},
+		{"any origin", cors.Options{
+			UnsafeReflectAnyOrigin: true,
+		}},
+	}
+	for _, test := range tests {
+		test.options.AllowedHeaders = cors.DefaultHeadersWith("Authorization")
+		test.options.ReflectOrigin = true
+		test.options.AllowCredentials = true
+		c, err := test.options.NewCORS()
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		w := httptest.NewRecorder()
+		c.ValidatePreflight(w, buildPreflightRequest("https://app.theyakka.com"),
+			func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+				if error != nil {
+					t.Errorf("%s: %s", test.name, error)
+				}
+			})
+		if w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "https://app.theyakka.com" ||
+			w.Header().Get(cors.HeaderKeyAccCtlResAllowCreds) != "true" {
+			t.Errorf("%s: expected the origin to be reflected with credentials", test.name)
+		}
+
+		w = httptest.NewRecorder()
+		_ = c.ApplyActualResponseHeaders(w, buildActualRequest(http.MethodGet, "https://app.theyakka.com"))
+		if w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "https://app.theyakka.com" ||
+			w.Header().Get(cors.HeaderKeyVary) != cors.HeaderKeyReqOrigin {
+			t.Errorf("%s: expected the origin to be reflected and varied on", test.name)
+		}
+
+		w = httptest.NewRecorder()
+		req := buildActualRequest(http.MethodGet, "https://app.theyakka.com")
+		req.Header.Set(cors.HeaderKeyReqOrigin, "not an origin")
+		if err := c.ApplyActualResponseHeaders(w, req); err == nil {
+			t.Errorf("%s: expected an invalid origin to never be reflected", test.name)
+		}
+
+		w = httptest.NewRecorder()
+		req.Header.Set(cors.HeaderKeyReqOrigin, cors.OriginNull)
+		if err := c.ApplyActualResponseHeaders(w, req); err == nil || w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "" {
+			t.Errorf("%s: expected the null origin to never be reflected", test.name)
+		}
+	}
+}
+
+func TestReflectOriginConfiguration(t *testing.T) {
+	tests := []struct {
+		name    string
+		options cors.Options
+		valid   bool
+	}{
+		{"reflect any origin", cors.Options{ReflectOrigin: true}, false},
+		{"reflect wildcard origin", cors.Options{ReflectOrigin: true, AllowedOrigins: cors.AllowAllOrigins}, false},
+		{"unsafe reflect any origin", cors.Options{ReflectOrigin: true, UnsafeReflectAnyOrigin: true,
+			AllowCredentials: true}, true},
+		{"credentials without reflection", cors.Options{UnsafeReflectAnyOrigin: true, AllowCredentials: true}, false},
+	}
+	for _, test := range tests {
+		if err := test.options.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid to be %v but got %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestOptionsWarnings(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  cors.Options
+		expected int
+	}{
+		{"safe", cors.Options{AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+			ReflectOrigin: true, AllowCredentials: true}, 0},
+		{"unsafe reflect any origin", cors.Options{ReflectOrigin: true, UnsafeReflectAnyOrigin: true,
+			AllowCredentials: true}, 1},
+		{"unsafe flag without reflection", cors.Options{UnsafeReflectAnyOrigin: true}, 1},
+		{"null origin with credentials", cors.Options{AllowedOrigins: []cors.OriginMatcher{cors.EM("null")},
+			AllowCredentials: true}, 1},
+		{"fail open with credentials", cors.Options{OriginStore: &cors.MemoryOriginStore{},
+			OriginStoreFailOpen: true, AllowCredentials: true}, 1},
+	}
+	for _, test := range tests {
+		if warnings := test.options.Warnings(); len(warnings) != test.expected {
+			t.Errorf("%s: expected %d warnings but got %v", test.name, test.expected, warnings)
+		}
+	}
+}
+
 func buildPreflightRequest(url string) *http.Request {
 	req, _ := http.NewRequest(http.MethodOptions, url, nil)
 	req.Header.Set(cors.HeaderKeyReqOrigin, url)
@@ -222,3 +456,41 @@ func fakeHandler(c *cors.CORS) http.Handler {
 		})
 	})
 }
+
+func benchmarkOrigins(count int, format string) []cors.OriginMatcher {
+	origins := make([]cors.OriginMatcher, 0, count+1)
+	for i := 0; i < count; i++ {
+		value := fmt.Sprintf(format, i)
+		if strings.Contains(value, "*") {
+			origins = append(origins, cors.WC(value))
+		} else {
+			origins = append(origins, cors.EM(value))
+		}
+	}
+	return origins
+}
+
+func benchmarkPreflight(b *testing.B, origins []cors.OriginMatcher, origin string) {
+	o := cors.Options{
+		AllowedOrigins: origins,
+		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		b.Error(err)
+		return
+	}
+
+	req := buildPreflightRequest(origin)
+	w := httptest.NewRecorder()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		c.ValidatePreflight(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+			if error != nil {
+				b.Fatal(error)
+			}
+		})
+	}
+}
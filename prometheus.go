@@ -0,0 +1,196 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the default histogram buckets (in seconds) used by
+// PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{
+	0.000001, 0.0000025, 0.000005, 0.00001, 0.000025, 0.00005,
+	0.0001, 0.00025, 0.0005, 0.001, 0.01, 0.1,
+}
+
+// PrometheusMetrics is a Metrics implementation that exposes its counters using the
+// Prometheus text exposition format. It does not depend on the Prometheus client library.
+// Use it as the http.Handler for your metrics endpoint (or for a path on it). It exposes:
+//
+//	cors_decisions_total               counter of decisions by kind, policy, result and reason
+//	cors_decision_duration_seconds     histogram of validation latency by kind and policy
+type PrometheusMetrics struct {
+	buckets    []float64
+	mu         sync.Mutex
+	counters   map[prometheusCounterKey]uint64
+	histograms map[prometheusHistogramKey]*prometheusHistogram
+}
+
+// prometheusCounterKey contains the label values for a decision counter.
+type prometheusCounterKey struct {
+	kind   string
+	policy string
+	result string
+	reason string
+}
+
+// prometheusHistogramKey contains the label values for a latency histogram.
+type prometheusHistogramKey struct {
+	kind   string
+	policy string
+}
+
+// prometheusHistogram contains the (non-cumulative) bucket counts for a histogram.
+type prometheusHistogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheusMetrics creates a new PrometheusMetrics instance. If no buckets are passed
+// then DefaultLatencyBuckets will be used. The buckets are sorted and duplicates are removed
+// (the +Inf bucket is always added). If any of the buckets are NaN or infinite, the function
+// will panic.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	sorted := make([]float64, 0, len(buckets))
+	for _, bucket := range buckets {
+		if math.IsNaN(bucket) || math.IsInf(bucket, 0) {
+			panic("cors: histogram buckets must be finite numbers")
+		}
+		sorted = append(sorted, bucket)
+	}
+	sort.Float64s(sorted)
+	buckets = sorted[:0]
+	for i, bucket := range sorted {
+		if i == 0 || bucket != sorted[i-1] {
+			buckets = append(buckets, bucket)
+		}
+	}
+	return &PrometheusMetrics{
+		buckets:    buckets,
+		counters:   map[prometheusCounterKey]uint64{},
+		histograms: map[prometheusHistogramKey]*prometheusHistogram{},
+	}
+}
+
+// ObserveDecision implements the Metrics interface.
+func (pm *PrometheusMetrics) ObserveDecision(decision Decision) {
+	counterKey := prometheusCounterKey{
+		kind:   decision.Kind.String(),
+		policy: decision.Policy,
+		result: "rejected",
+		reason: decision.Reason(),
+	}
+	if decision.Allowed {
+		counterKey.result = "allowed"
+	}
+	histogramKey := prometheusHistogramKey{kind: counterKey.kind, policy: decision.Policy}
+	seconds := decision.Latency.Seconds()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.counters[counterKey]++
+	histogram, ok := pm.histograms[histogramKey]
+	if !ok {
+		histogram = &prometheusHistogram{counts: make([]uint64, len(pm.buckets))}
+		pm.histograms[histogramKey] = histogram
+	}
+	// the counts are stored per bucket and made cumulative when they are written
+	if i := sort.SearchFloat64s(pm.buckets, seconds); i < len(pm.buckets) {
+		histogram.counts[i]++
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+// ServeHTTP writes all of the metrics using the Prometheus text exposition format.
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writer := bufio.NewWriter(w)
+	pm.writeTo(writer)
+	_ = writer.Flush()
+}
+
+// writeTo writes the metrics in a stable (sorted) order.
+func (pm *PrometheusMetrics) writeTo(w *bufio.Writer) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	counterKeys := make([]prometheusCounterKey, 0, len(pm.counters))
+	for key := range pm.counters {
+		counterKeys = append(counterKeys, key)
+	}
+	sort.Slice(counterKeys, func(i, j int) bool {
+		a, b := counterKeys[i], counterKeys[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.policy != b.policy {
+			return a.policy < b.policy
+		}
+		if a.result != b.result {
+			return a.result < b.result
+		}
+		return a.reason < b.reason
+	})
+	w.WriteString("# HELP cors_decisions_total The number of CORS decisions by kind, policy, result and reason.\n")
+	w.WriteString("# TYPE cors_decisions_total counter\n")
+	for _, key := range counterKeys {
+		w.WriteString("cors_decisions_total{kind=\"" + prometheusLabel(key.kind) +
+			"\",policy=\"" + prometheusLabel(key.policy) +
+			"\",result=\"" + prometheusLabel(key.result) +
+			"\",reason=\"" + prometheusLabel(key.reason) + "\"} ")
+		w.WriteString(strconv.FormatUint(pm.counters[key], 10) + "\n")
+	}
+
+	histogramKeys := make([]prometheusHistogramKey, 0, len(pm.histograms))
+	for key := range pm.histograms {
+		histogramKeys = append(histogramKeys, key)
+	}
+	sort.Slice(histogramKeys, func(i, j int) bool {
+		a, b := histogramKeys[i], histogramKeys[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.policy < b.policy
+	})
+	w.WriteString("# HELP cors_decision_duration_seconds The time taken to make CORS decisions.\n")
+	w.WriteString("# TYPE cors_decision_duration_seconds histogram\n")
+	for _, key := range histogramKeys {
+		histogram := pm.histograms[key]
+		labels := "kind=\"" + prometheusLabel(key.kind) + "\",policy=\"" + prometheusLabel(key.policy) + "\""
+		var cumulative uint64
+		for i, bucket := range pm.buckets {
+			cumulative += histogram.counts[i]
+			w.WriteString("cors_decision_duration_seconds_bucket{" + labels + ",le=\"" +
+				strconv.FormatFloat(bucket, 'g', -1, 64) + "\"} " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString("cors_decision_duration_seconds_bucket{" + labels + ",le=\"+Inf\"} " +
+			strconv.FormatUint(histogram.count, 10) + "\n")
+		w.WriteString("cors_decision_duration_seconds_sum{" + labels + "} " +
+			strconv.FormatFloat(histogram.sum, 'g', -1, 64) + "\n")
+		w.WriteString("cors_decision_duration_seconds_count{" + labels + "} " +
+			strconv.FormatUint(histogram.count, 10) + "\n")
+	}
+}
+
+// prometheusLabelReplacer escapes label values for the text exposition format.
+var prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusLabel returns the escaped label value.
+func prometheusLabel(value string) string {
+	return prometheusLabelReplacer.Replace(value)
+}
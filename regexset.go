@@ -0,0 +1,223 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// regexLeafSize is the maximum number of expressions in a leaf of the regexTree. The
+// expressions in a leaf are run one at a time (once the leaf is known to contain a match).
+const regexLeafSize = 8
+
+// regexSet evaluates a list of regular expression rules without having to run every one of
+// them against every origin. Most origin expressions end with a literal (e.g.
+// `\.theyakka\.com`), so those literal suffixes are stored in a (reversed) byte trie that
+// acts as a set-matching automaton: a single scan of the origin finds every expression that
+// could possibly match and only those candidates are run. Expressions without a literal
+// suffix are stored in a regexTree.
+type regexSet struct {
+	// rules contains all of the rule indexes (in declaration order)
+	rules []int
+	// suffixes is the root of the reversed literal suffix trie
+	suffixes *suffixNode
+	// tree contains the expressions without a suffix (or nil)
+	tree *regexTree
+}
+
+// suffixNode is a single byte in the reversed literal suffix trie.
+type suffixNode struct {
+	keys     []byte
+	children []*suffixNode
+	// rules contains the rules whose literal suffix ends at this node
+	rules []int
+}
+
+// regexTree is a binary tree of combined expressions. Each node combines all of the
+// expressions below it into a single (non-capturing) alternation. The regexp package
+// factors the common prefixes out of the alternatives, so an origin that doesn't match any
+// of the expressions is rejected by a single scan of the root. If it does match, the tree
+// is descended (left first, so that the lowest rule wins) which takes roughly log2(n) more
+// scans. The regexp package can't report which alternative matched without capture groups,
+// and capture groups prevent the prefixes from being factored (which makes a single large
+// alternation far slower than running the expressions one at a time). The trade-off is
+// memory: each level of the tree costs about as much as compiling every expression on its
+// own (see BenchmarkWildcardPreflight/regex-nosuffix).
+type regexTree struct {
+	// regex is the combined expression. It is nil if the combined expression could not be
+	// compiled (e.g. it was too large), in which case both children are always checked.
+	regex *regexp.Regexp
+	// rules contains the rules in the node (in declaration order)
+	rules       []int
+	left, right *regexTree
+}
+
+// newRegexSet compiles the regular expression rules. If there are no rules, nil will be
+// returned.
+func newRegexSet(matchers []OriginMatcher, rules []int) *regexSet {
+	if len(rules) == 0 {
+		return nil
+	}
+	set := &regexSet{rules: rules, suffixes: &suffixNode{}}
+	var unfiltered []int
+	for _, i := range rules {
+		suffix := literalSuffix(matchers[i].(*Match).Value)
+		if suffix == "" {
+			unfiltered = append(unfiltered, i)
+			continue
+		}
+		node := set.suffixes
+		for b := len(suffix) - 1; b >= 0; b-- {
+			node = node.insert(suffix[b])
+		}
+		node.rules = append(node.rules, i)
+	}
+	if len(unfiltered) > 0 {
+		set.tree = newRegexTree(matchers, unfiltered)
+	}
+	return set
+}
+
+// newRegexTree builds the tree node for the (non-empty) rules.
+func newRegexTree(matchers []OriginMatcher, rules []int) *regexTree {
+	node := &regexTree{rules: rules, regex: combineRegexes(matchers, rules)}
+	if len(rules) > regexLeafSize {
+		middle := len(rules) / 2
+		node.left = newRegexTree(matchers, rules[:middle])
+		node.right = newRegexTree(matchers, rules[middle:])
+	}
+	return node
+}
+
+// combineRegexes combines the expressions into a single alternation. If the combined
+// expression cannot be compiled, nil will be returned.
+func combineRegexes(matchers []OriginMatcher, rules []int) *regexp.Regexp {
+	if len(rules) == 1 {
+		return matchers[rules[0]].(*Match).regex
+	}
+	var pattern strings.Builder
+	pattern.WriteString(`^(?:`)
+	for n, i := range rules {
+		if n > 0 {
+			pattern.WriteByte('|')
+		}
+		pattern.WriteString(`(?:` + matchers[i].(*Match).Value + `)`)
+	}
+	pattern.WriteString(`)$`)
+	regex, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return nil
+	}
+	return regex
+}
+
+// match returns the index of the first regex rule that matches the origin (or best if there
+// is no better match).
+func (rs *regexSet) match(matchers []OriginMatcher, origin string, best int) int {
+	node := rs.suffixes
+	for b := len(origin) - 1; b >= 0 && node != nil; b-- {
+		if node = node.child(origin[b]); node != nil {
+			best = firstRegexMatch(matchers, node.rules, origin, best)
+		}
+	}
+	if rs.tree != nil {
+		if i := rs.tree.match(matchers, origin, best, false); i >= 0 {
+			best = i
+		}
+	}
+	return best
+}
+
+// match returns the index of the first rule in the node that matches the origin (and is
+// lower than best) or -1. If known is true, one of the rules in the node is known to match.
+func (rt *regexTree) match(matchers []OriginMatcher, origin string, best int, known bool) int {
+	if best >= 0 && rt.rules[0] > best {
+		return -1
+	}
+	if !known && rt.regex != nil {
+		if !rt.regex.MatchString(origin) {
+			return -1
+		}
+		known = true
+	}
+	if rt.left == nil {
+		if i := firstRegexMatch(matchers, rt.rules, origin, best); i != best {
+			return i
+		}
+		return -1
+	}
+	if i := rt.left.match(matchers, origin, best, false); i >= 0 {
+		return i
+	}
+	return rt.right.match(matchers, origin, best, known)
+}
+
+// insert returns the child node for the byte (creating it if needed).
+func (n *suffixNode) insert(b byte) *suffixNode {
+	if child := n.child(b); child != nil {
+		return child
+	}
+	child := &suffixNode{}
+	n.keys = append(n.keys, b)
+	n.children = append(n.children, child)
+	return child
+}
+
+// child returns the child node for the byte (or nil).
+func (n *suffixNode) child(b byte) *suffixNode {
+	for i, key := range n.keys {
+		if key == b {
+			return n.children[i]
+		}
+	}
+	return nil
+}
+
+// firstRegexMatch returns the lowest rule index (that is lower than best) whose expression
+// matches the origin. If none match, best is returned.
+func firstRegexMatch(matchers []OriginMatcher, rules []int, origin string, best int) int {
+	for _, i := range rules {
+		if best >= 0 && i > best {
+			break
+		}
+		if matchers[i].(*Match).regex.MatchString(origin) {
+			return i
+		}
+	}
+	return best
+}
+
+// literalSuffix returns the literal text that any value matching the expression must end
+// with. If there is no such literal (or it cannot be determined), an empty string will be
+// returned.
+func literalSuffix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	suffix := ""
+	for i := len(subs) - 1; i >= 0; i-- {
+		sub := subs[i]
+		switch {
+		case sub.Op == syntax.OpLiteral && sub.Flags&syntax.FoldCase == 0:
+			suffix = string(sub.Rune) + suffix
+		case suffix == "" && (sub.Op == syntax.OpEndText || sub.Op == syntax.OpEndLine ||
+			sub.Op == syntax.OpEmptyMatch):
+			continue
+		default:
+			return suffix
+		}
+	}
+	return suffix
+}
@@ -0,0 +1,187 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reloadable wraps a CORS instance so that the policy can be changed while the server is
+// running. Each reload compiles a brand new (immutable) CORS instance and swaps it in
+// atomically, so in-flight requests always see a consistent policy. If a reload fails,
+// the last good policy is kept. Reloadable exposes the same validation functions as CORS.
+type Reloadable struct {
+	current atomic.Value
+	onError func(err error)
+	// mu ensures that reloads are applied one at a time
+	mu sync.Mutex
+}
+
+// OptionsWarning is passed to the Reloadable error callback for each of the Options.Warnings
+// of a policy that has been applied. The policy is still used.
+type OptionsWarning struct {
+	// Warning is the description of the risky choice.
+	Warning string
+}
+
+// Error implements the builtin error interface for our custom OptionsWarning type
+func (ow *OptionsWarning) Error() string {
+	return "cors: warning: " + ow.Warning
+}
+
+// NewReloadable creates a new Reloadable using the initial Options. onError is optional and
+// will be called whenever a reload (or file watch) fails. It is also called with an
+// *OptionsWarning for each of the Options.Warnings whenever a policy is applied.
+func NewReloadable(o *Options, onError func(err error)) (*Reloadable, error) {
+	c, err := o.NewCORS()
+	if err != nil {
+		return nil, err
+	}
+	rl := &Reloadable{onError: onError}
+	rl.current.Store(c)
+	rl.reportWarnings(o)
+	return rl, nil
+}
+
+// Current returns the currently active CORS instance.
+func (rl *Reloadable) Current() *CORS {
+	return rl.current.Load().(*CORS)
+}
+
+// Reload compiles a new CORS instance from the Options and, if it is valid, swaps it in. If
+// the Options are not valid, the current policy will be kept, the error callback will be
+// called and the error will be returned.
+func (rl *Reloadable) Reload(o *Options) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	c, err := o.NewCORS()
+	if err != nil {
+		rl.reportError(err)
+		return err
+	}
+	rl.current.Store(c)
+	rl.reportWarnings(o)
+	return nil
+}
+
+// ReloadFile loads the Options from a file (see LoadOptionsFile) and reloads them.
+func (rl *Reloadable) ReloadFile(path string) error {
+	return rl.reloadWith(path, LoadOptionsFile)
+}
+
+// DefaultWatchInterval is the interval used by WatchFile if the interval is not positive.
+const DefaultWatchInterval = time.Second
+
+// WatchFile polls the file every interval and reloads the policy whenever the file changes.
+// If the interval is not positive, DefaultWatchInterval will be used. The load function is
+// used to create the Options from the file. If it is nil, LoadOptionsFile will be used.
+// Failures are reported via the error callback and the current policy is kept. Call the
+// returned function to stop watching.
+func (rl *Reloadable) WatchFile(path string, interval time.Duration, load func(path string) (*Options, error)) (stop func()) {
+	if load == nil {
+		load = LoadOptionsFile
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	done := make(chan struct{})
+	var lastModTime time.Time
+	var lastSize int64 = -1
+	if info, err := os.Stat(path); err == nil {
+		// we only want to reload once the file has changed from its current state
+		lastModTime, lastSize = info.ModTime(), info.Size()
+	}
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				rl.reportError(err)
+				continue
+			}
+			if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+				continue
+			}
+			lastModTime, lastSize = info.ModTime(), info.Size()
+			_ = rl.reloadWith(path, load)
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// reloadWith loads the Options using the load function and reloads them.
+func (rl *Reloadable) reloadWith(path string, load func(path string) (*Options, error)) error {
+	o, err := load(path)
+	if err != nil {
+		rl.reportError(err)
+		return err
+	}
+	return rl.Reload(o)
+}
+
+// reportWarnings calls the error callback with each of the warnings for the Options.
+func (rl *Reloadable) reportWarnings(o *Options) {
+	if rl.onError == nil {
+		return
+	}
+	for _, warning := range o.Warnings() {
+		rl.onError(&OptionsWarning{Warning: warning})
+	}
+}
+
+// reportError calls the error callback (if there is one).
+func (rl *Reloadable) reportError(err error) {
+	if rl.onError != nil {
+		rl.onError(err)
+	}
+}
+
+// ValidatePreflight executes ValidatePreflight using the current policy.
+func (rl *Reloadable) ValidatePreflight(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	rl.Current().ValidatePreflight(w, r, handler)
+}
+
+// ValidateRequest executes ValidateRequest using the current policy.
+func (rl *Reloadable) ValidateRequest(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	rl.Current().ValidateRequest(w, r, handler)
+}
+
+// ApplyActualResponseHeaders executes ApplyActualResponseHeaders using the current policy.
+func (rl *Reloadable) ApplyActualResponseHeaders(w http.ResponseWriter, r *http.Request) *ValidationError {
+	return rl.Current().ApplyActualResponseHeaders(w, r)
+}
+
+// Handler is the same as CORS.Handler except that it uses the current policy for each
+// request.
+func (rl *Reloadable) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rl.Current().serveHTTP(w, r, next)
+	})
+}
+
+// HandlerFunc is the same as Handler, but for http.HandlerFunc values.
+func (rl *Reloadable) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return rl.Handler(next).ServeHTTP
+}
+
+// policyFor implements the Policy interface.
+func (rl *Reloadable) policyFor(r *http.Request) (*CORS, *http.Request) {
+	return rl.Current(), r
+}
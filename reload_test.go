@@ -0,0 +1,189 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"errors"
+	"github.com/theyakka/cors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadable(t *testing.T) {
+	var errs []error
+	rl, err := cors.NewReloadable(&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}, func(err error) { errs = append(errs, err) })
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !rl.Current().IsOriginAllowed("https://theyakka.com") || rl.Current().IsOriginAllowed("https://acme.com") {
+		t.Error("expected the initial policy to be active")
+	}
+
+	if err := rl.Reload(&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://acme.com")},
+	}); err != nil {
+		t.Error(err)
+		return
+	}
+	if !rl.Current().IsOriginAllowed("https://acme.com") {
+		t.Error("expected the reloaded policy to be active")
+	}
+
+	// an invalid policy should be rejected and the last good policy kept
+	err = rl.Reload(&cors.Options{AllowedOrigins: cors.AllowAllOrigins, AllowCredentials: true})
+	if err == nil || len(errs) != 1 {
+		t.Error("expected the invalid policy to be reported")
+	}
+	if !rl.Current().IsOriginAllowed("https://acme.com") || rl.Current().IsOriginAllowed("https://theyakka.com") {
+		t.Error("expected the last good policy to have been kept")
+	}
+}
+
+func TestReloadableWarnings(t *testing.T) {
+	var warnings []string
+	rl, err := cors.NewReloadable(&cors.Options{ReflectOrigin: true, UnsafeReflectAnyOrigin: true}, func(err error) {
+		var warning *cors.OptionsWarning
+		if errors.As(err, &warning) {
+			warnings = append(warnings, warning.Warning)
+		}
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected the initial policy warning to be reported but got %v", warnings)
+	}
+	if err := rl.Reload(&cors.Options{ReflectOrigin: true, UnsafeReflectAnyOrigin: true, AllowCredentials: true}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[1], "with credentials") {
+		t.Errorf("expected the reloaded policy warning to be reported but got %v", warnings)
+	}
+}
+
+func TestOptionsAreCopied(t *testing.T) {
+	o := &cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	o.AllowedOrigins[0] = cors.EM("https://acme.com")
+	o.AllowCredentials = true
+	w := httptest.NewRecorder()
+	if c.ApplyActualResponseHeaders(w, buildActualRequest(http.MethodGet, "https://theyakka.com")) != nil {
+		t.Error("expected the original policy to be unaffected")
+	}
+	if w.Header().Get(cors.HeaderKeyAccCtlResAllowCreds) != "" {
+		t.Error("expected the original policy to be unaffected")
+	}
+}
+
+func TestReloadableHandler(t *testing.T) {
+	rl, err := cors.NewReloadable(&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := rl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, buildActualRequest(http.MethodGet, "https://acme.com"))
+		return w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin)
+	}
+	if serve() != "" {
+		t.Error("expected the origin to not be allowed")
+	}
+	_ = rl.Reload(&cors.Options{AllowedOrigins: []cors.OriginMatcher{cors.EM("https://acme.com")}})
+	if serve() != "https://acme.com" {
+		t.Error("expected the handler to use the reloaded policy")
+	}
+}
+
+func TestReloadableWatchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cors")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cors.yaml")
+	if err := ioutil.WriteFile(path, []byte("allowed_origins: [https://theyakka.com]\n"), 0600); err != nil {
+		t.Error(err)
+		return
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	rl, err := cors.NewReloadable(&cors.Options{}, func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := rl.ReloadFile(path); err != nil {
+		t.Error(err)
+		return
+	}
+	stop := rl.WatchFile(path, 5*time.Millisecond, nil)
+	defer stop()
+
+	_ = ioutil.WriteFile(path, []byte("allowed_origins: [https://acme.com, https://theyakka.com]\n"), 0600)
+	if !waitFor(func() bool { return rl.Current().IsOriginAllowed("https://acme.com") }) {
+		t.Error("expected the policy to have been reloaded from the file")
+	}
+
+	_ = ioutil.WriteFile(path, []byte("allowed_origins: [https://acme.com/path]\n"), 0600)
+	if !waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return len(errs) > 0 }) {
+		t.Error("expected the invalid file to be reported")
+	}
+	if !rl.Current().IsOriginAllowed("https://acme.com") {
+		t.Error("expected the last good policy to have been kept")
+	}
+}
+
+func TestReloadableWatchFileInterval(t *testing.T) {
+	rl, err := cors.NewReloadable(&cors.Options{}, nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// a non-positive interval should use the default rather than panic
+	rl.WatchFile("cors.yaml", 0, nil)()
+	rl.WatchFile("cors.yaml", -time.Second, nil)()
+}
+
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ValidateRequest will execute the CORS flow for an actual (non-preflight) request. If the
+// request passes validation, the appropriate CORS response headers will be applied to the
+// response before the handler is executed. If it fails, no CORS headers will be applied
+// and error will describe the reason for the failure.
+func (c *CORS) ValidateRequest(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	handler(w, r, c.ApplyActualResponseHeaders(w, r))
+}
+
+// ApplyActualResponseHeaders validates an actual (non-preflight) request and, if it is
+// allowed, applies the Access-Control-Allow-Origin, Access-Control-Allow-Credentials and
+// Access-Control-Expose-Headers headers to the response. If the request is not allowed, a
+// ValidationError describing the reason for the failure will be returned.
+func (c *CORS) ApplyActualResponseHeaders(w http.ResponseWriter, r *http.Request) *ValidationError {
+	if (!c.observing && c.tracer == nil) || firstValue(r.Header[HeaderKeyReqOrigin]) == "" {
+		// requests without an origin (e.g. same-origin or server to server requests) aren't
+		// CORS requests so no decision is reported (or traced) for them
+		err, _ := c.applyActualResponseHeaders(r.Context(), w, r)
+		return err
+	}
+	start := time.Now()
+	ctx, span := c.startSpan(r.Context(), SpanActual)
+	err, rule := c.applyActualResponseHeaders(ctx, w, r)
+	if span != nil {
+		c.endDecisionSpan(span, r, err, false)
+	}
+	if c.observing {
+		c.observeDecision(r, DecisionActual, err, rule, false, start)
+	}
+	return err
+}
+
+// applyActualResponseHeaders does the work for ApplyActualResponseHeaders. If one of the
+// AllowedOrigins values matched the origin, it will be returned as the rule.
+func (c *CORS) applyActualResponseHeaders(ctx context.Context, w http.ResponseWriter, r *http.Request) (*ValidationError, OriginMatcher) {
+	headers := w.Header()
+	// a preflight should never be treated as an actual request
+	if r.Method == http.MethodOptions && firstValue(r.Header[HeaderKeyAccCtlReqMethod]) != "" {
+		return preflightError(RequestErrIsPreflight), nil
+	}
+
+	// if we are not allowing all origins then the response will differ based on the origin
+	// so we need to make sure we don't poison any cache
+	if !c.areAllOriginsAllowed || c.reflectOrigin {
+		addVary(headers, varyOrigin)
+	}
+
+	origin := firstValue(r.Header[HeaderKeyReqOrigin])
+	if origin == "" {
+		// no origin means this isn't a CORS request
+		return preflightError(RequestErrOriginMissing), nil
+	}
+	err, rule, _ := c.validateOrigin(ctx, r, origin, RequestErrOriginNotAllowed)
+	if err != nil {
+		// the origin wasn't whitelisted (or wasn't a valid origin)
+		return err, nil
+	}
+	if !c.IsMethodAllowed(strings.ToUpper(r.Method)) {
+		// the method wasn't whitelisted
+		return preflightError(RequestErrMethodNotAllowed), rule
+	}
+
+	if c.areAllOriginsAllowed && !c.reflectOrigin {
+		headers[HeaderKeyAccCtlResAllowOrigin] = headerValueAll
+	} else {
+		headers[HeaderKeyAccCtlResAllowOrigin] = r.Header[HeaderKeyReqOrigin][:1:1]
+	}
+
+	// let the browser know which headers the client can read from the response
+	if c.exposedHeadersValue != nil {
+		headers[HeaderKeyAccCtlResExposeHeaders] = c.exposedHeadersValue
+	}
+
+	// pass through the allow credentials header
+	if c.options.AllowCredentials {
+		headers[HeaderKeyAccCtlResAllowCreds] = headerValueTrue
+	}
+	return nil, rule
+}
+
+// ExposeHeaders adds headers to the Access-Control-Expose-Headers header of the response.
+// It is intended to be called from inside your handler (after the CORS headers have been
+// applied) when a response includes headers that the client needs to read (e.g. pagination
+// headers). If the CORS headers were not applied (the request wasn't allowed), it does
+// nothing. The "*" value is ignored if the response allows credentials.
+func ExposeHeaders(w http.ResponseWriter, headers ...string) {
+	responseHeaders := w.Header()
+	if len(responseHeaders[HeaderKeyAccCtlResAllowOrigin]) == 0 {
+		// this isn't an (allowed) CORS response
+		return
+	}
+	withCredentials := firstValue(responseHeaders[HeaderKeyAccCtlResAllowCreds]) == "true"
+	existing := strings.Join(responseHeaders[HeaderKeyAccCtlResExposeHeaders], ", ")
+	if existing == "*" && !withCredentials {
+		// everything is already exposed
+		return
+	}
+	exposed := existing
+	for _, header := range headers {
+		if header == "*" {
+			if withCredentials {
+				continue
+			}
+			exposed = "*"
+			break
+		}
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" || headerListContains(exposed, header) {
+			continue
+		}
+		if exposed == "" {
+			exposed = header
+		} else {
+			exposed += ", " + header
+		}
+	}
+	if exposed != existing {
+		responseHeaders.Set(HeaderKeyAccCtlResExposeHeaders, exposed)
+	}
+}
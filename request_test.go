@@ -0,0 +1,184 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestValidRequest(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{
+			cors.RX(`https?://.*\.theyakka\.com`), cors.RX(`https?://theyakka\.com`),
+		},
+		ExposedHeaders:   []string{"x-request-id"},
+		AllowCredentials: true,
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildActualRequest(http.MethodGet, "https://theyakka.com")
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error != nil {
+			t.Error("expected no errors to have occurred")
+			return
+		}
+		header := w.Header()
+		originOK := header.Get(cors.HeaderKeyAccCtlResAllowOrigin) == "https://theyakka.com"
+		credsOK := header.Get(cors.HeaderKeyAccCtlResAllowCreds) == "true"
+		exposeOK := header.Get(cors.HeaderKeyAccCtlResExposeHeaders) == "X-Request-Id"
+		varyOK := header.Get("Vary") == cors.HeaderKeyReqOrigin
+		if !originOK || !credsOK || !exposeOK || !varyOK {
+			t.Error("response headers don't match expected")
+		}
+	})
+}
+
+func TestInvalidOriginRequest(t *testing.T) {
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildActualRequest(http.MethodGet, "https://google.com")
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil {
+			t.Error("expected an error to have occurred")
+			return
+		}
+		if error.Code != cors.RequestErrOriginNotAllowed {
+			t.Error("expected error code to indicate the origin wasn't allowed")
+		}
+		if w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "" {
+			t.Error("expected no allow origin header to have been set")
+		}
+	})
+}
+
+func TestInvalidMethodRequest(t *testing.T) {
+	c, err := (&cors.Options{}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildActualRequest(http.MethodDelete, "https://theyakka.com")
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.RequestErrMethodNotAllowed {
+			t.Error("expected error code to indicate the method wasn't allowed")
+		}
+	})
+}
+
+func TestMissingOriginRequest(t *testing.T) {
+	c, err := cors.AllowAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://theyakka.com", nil)
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.RequestErrOriginMissing {
+			t.Error("expected error code to indicate the origin was missing")
+		}
+	})
+}
+
+func TestPreflightAsActualRequest(t *testing.T) {
+	c, err := cors.AllowAll()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	req := buildPreflightRequest("https://theyakka.com")
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, req, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.RequestErrIsPreflight {
+			t.Error("expected error code to indicate the request was a preflight")
+		}
+	})
+}
+
+func TestExposeAllHeaders(t *testing.T) {
+	c, err := (&cors.Options{ExposedHeaders: []string{"*"}}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	w := httptest.NewRecorder()
+	c.ValidateRequest(w, buildActualRequest(http.MethodGet, "https://theyakka.com"),
+		func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+			if error != nil {
+				t.Error(error)
+			}
+		})
+	if w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders) != "*" {
+		t.Error("expected all headers to be exposed")
+	}
+
+	_, err = (&cors.Options{ExposedHeaders: []string{"*"}, AllowCredentials: true}).NewCORS()
+	if validationErr, ok := err.(*cors.ValidationError); !ok || validationErr.Code != cors.ConfigurationInvalid {
+		t.Error("expected the wildcard exposed header to be rejected when credentials are allowed")
+	}
+}
+
+func TestExposeHeadersFromHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  cors.Options
+		origin   string
+		expose   []string
+		expected string
+	}{
+		{"append", cors.Options{ExposedHeaders: []string{"X-Request-Id"}}, "https://theyakka.com",
+			[]string{"x-total-count", "X-Request-Id", "Link"}, "X-Request-Id, X-Total-Count, Link"},
+		{"wildcard", cors.Options{}, "https://theyakka.com",
+			[]string{"Link", "*"}, "*"},
+		{"wildcard with credentials", cors.Options{ExposedHeaders: []string{"X-Request-Id"}, AllowCredentials: true,
+			AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")}}, "https://theyakka.com",
+			[]string{"*", "Link"}, "X-Request-Id, Link"},
+		{"not allowed", cors.Options{AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")}},
+			"https://acme.com", []string{"Link"}, ""},
+	}
+	for _, test := range tests {
+		c, err := test.options.NewCORS()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cors.ExposeHeaders(w, test.expose...)
+		}))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, buildActualRequest(http.MethodGet, test.origin))
+		if exposed := w.Header().Get(cors.HeaderKeyAccCtlResExposeHeaders); exposed != test.expected {
+			t.Errorf("%s: expected '%s' but got '%s'", test.name, test.expected, exposed)
+		}
+	}
+}
+
+func buildActualRequest(method string, url string) *http.Request {
+	req, _ := http.NewRequest(method, url, nil)
+	req.Header.Set(cors.HeaderKeyReqOrigin, url)
+	return req
+}
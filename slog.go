@@ -0,0 +1,84 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+//go:build go1.21
+// +build go1.21
+
+package cors
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger is the Logger returned by NewSlogLogger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a Logger that writes the decisions to the slog.Logger. If logger is
+// nil, slog.Default() will be used. Each entry has the following attributes (empty values
+// are omitted): kind, allowed, origin, method, headers, rejected_headers, rule, policy,
+// tenant, code, reason, cached, latency and error.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+// Enabled implements the Logger interface.
+func (sl *slogLogger) Enabled(ctx context.Context, level LogLevel) bool {
+	return sl.logger.Enabled(ctx, slogLevel(level))
+}
+
+// LogDecision implements the Logger interface.
+func (sl *slogLogger) LogDecision(ctx context.Context, level LogLevel, entry LogEntry) {
+	decision := entry.Decision
+	attrs := make([]slog.Attr, 0, 14)
+	attrs = append(attrs,
+		slog.String("kind", decision.Kind.String()),
+		slog.Bool("allowed", decision.Allowed),
+		slog.String("origin", entry.Origin),
+		slog.String("method", entry.Method),
+	)
+	if len(entry.Headers) > 0 {
+		attrs = append(attrs, slog.Any("headers", entry.Headers))
+	}
+	if len(entry.RejectedHeaders) > 0 {
+		attrs = append(attrs, slog.Any("rejected_headers", entry.RejectedHeaders))
+	}
+	if decision.Rule != nil {
+		attrs = append(attrs, slog.String("rule", decision.Rule.String()))
+	}
+	if decision.Policy != "" {
+		attrs = append(attrs, slog.String("policy", decision.Policy))
+	}
+	if decision.Tenant != "" {
+		attrs = append(attrs, slog.String("tenant", decision.Tenant))
+	}
+	if !decision.Allowed {
+		attrs = append(attrs, slog.Int("code", int(decision.Code)), slog.String("reason", decision.Reason()))
+	}
+	attrs = append(attrs, slog.Bool("cached", decision.Cached), slog.Duration("latency", decision.Latency))
+	if entry.Error != nil && entry.Error.OriginalError != nil {
+		attrs = append(attrs, slog.String("error", entry.Error.OriginalError.Error()))
+	}
+	sl.logger.LogAttrs(ctx, slogLevel(level), entry.Message, attrs...)
+}
+
+// slogLevel converts the LogLevel into the matching slog.Level.
+func slogLevel(level LogLevel) slog.Level {
+	switch level {
+	case LogLevelDebug:
+		return slog.LevelDebug
+	case LogLevelWarn:
+		return slog.LevelWarn
+	case LogLevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
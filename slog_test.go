@@ -0,0 +1,64 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+//go:build go1.21
+// +build go1.21
+
+package cors_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/theyakka/cors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	c, err := (&cors.Options{
+		Name:           "api",
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		Logger:         cors.NewSlogLogger(logger),
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	// allowed preflights are logged at the debug level so this one will be skipped
+	req := buildPreflightRequest("https://theyakka.com")
+	req.Header.Del(cors.HeaderKeyAccCtlReqHeaders)
+	c.ValidatePreflight(httptest.NewRecorder(), req, handler)
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://theyakka.com"), handler)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Errorf("expected a single json entry: %s", err)
+		return
+	}
+	expected := map[string]interface{}{
+		"level":            "INFO",
+		"msg":              "cors preflight rejected",
+		"kind":             "preflight",
+		"allowed":          false,
+		"origin":           "https://theyakka.com",
+		"method":           "get",
+		"rejected_headers": []interface{}{"Authorization"},
+		"policy":           "api",
+		"reason":           "headers_not_allowed",
+	}
+	for key, value := range expected {
+		actual, _ := json.Marshal(entry[key])
+		wanted, _ := json.Marshal(value)
+		if !bytes.Equal(actual, wanted) {
+			t.Errorf("%s: expected %s but got %s", key, wanted, actual)
+		}
+	}
+}
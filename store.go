@@ -0,0 +1,224 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOriginStoreCacheTTL is the default amount of time an allowed origin returned by
+	// an OriginStore will be cached for.
+	DefaultOriginStoreCacheTTL = time.Minute
+	// DefaultOriginStoreNegativeCacheTTL is the default amount of time a disallowed origin
+	// returned by an OriginStore will be cached for.
+	DefaultOriginStoreNegativeCacheTTL = 10 * time.Second
+	// DefaultOriginStoreCacheSize is the default maximum number of origins that will be
+	// cached for an OriginStore.
+	DefaultOriginStoreCacheSize = 10000
+)
+
+// OriginStore is the interface that wraps looking up origins in an external source (such as
+// a database). The origin value will always be in its normalized form. Stores are consulted
+// after the AllowedOrigins values and the AllowOriginFunc and are always accessed via a
+// CachedOriginStore.
+type OriginStore interface {
+	LookupOrigin(ctx context.Context, origin string) (bool, error)
+}
+
+// CachedOriginStore wraps an OriginStore with an in-process TTL cache. Both allowed and
+// disallowed (negative) results are cached. Errors are never cached. Concurrent lookups
+// for the same origin will be coalesced so that only a single lookup hits the underlying
+// store.
+type CachedOriginStore struct {
+	store       OriginStore
+	ttl         time.Duration
+	negativeTTL time.Duration
+	timeout     time.Duration
+	maxEntries  int
+	mu          sync.Mutex
+	entries     map[string]cachedOrigin
+	lookups     map[string]*originLookup
+}
+
+// cachedOrigin is a cached OriginStore result.
+type cachedOrigin struct {
+	allowed bool
+	expires time.Time
+}
+
+// originLookup is an in-flight OriginStore lookup that one or more callers are waiting on.
+type originLookup struct {
+	done    chan struct{}
+	allowed bool
+	err     error
+}
+
+// NewCachedOriginStore creates a new CachedOriginStore. A zero ttl or negativeTTL will use
+// the default value and a negative value will disable caching for that result. If timeout
+// is greater than zero, lookups that take longer will fail with context.DeadlineExceeded.
+func NewCachedOriginStore(store OriginStore, ttl time.Duration, negativeTTL time.Duration, timeout time.Duration) *CachedOriginStore {
+	if ttl == 0 {
+		ttl = DefaultOriginStoreCacheTTL
+	}
+	if negativeTTL == 0 {
+		negativeTTL = DefaultOriginStoreNegativeCacheTTL
+	}
+	return &CachedOriginStore{
+		store:       store,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		timeout:     timeout,
+		maxEntries:  DefaultOriginStoreCacheSize,
+		entries:     map[string]cachedOrigin{},
+		lookups:     map[string]*originLookup{},
+	}
+}
+
+// LookupOrigin implements the OriginStore interface.
+func (cs *CachedOriginStore) LookupOrigin(ctx context.Context, origin string) (bool, error) {
+	cs.mu.Lock()
+	if entry, ok := cs.entries[origin]; ok {
+		if time.Now().Before(entry.expires) {
+			cs.mu.Unlock()
+			return entry.allowed, nil
+		}
+		delete(cs.entries, origin)
+	}
+	lookup, ok := cs.lookups[origin]
+	if !ok {
+		// nobody is looking this origin up yet so we'll kick off the lookup. it runs
+		// detached from the caller so that a cancelled request can't fail everybody else
+		// that is waiting on the same origin.
+		lookup = &originLookup{done: make(chan struct{})}
+		cs.lookups[origin] = lookup
+		go cs.lookup(origin, lookup)
+	}
+	cs.mu.Unlock()
+
+	if cs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.timeout)
+		defer cancel()
+	}
+	select {
+	case <-lookup.done:
+		return lookup.allowed, lookup.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// lookup executes the lookup against the underlying store and caches the result.
+func (cs *CachedOriginStore) lookup(origin string, lookup *originLookup) {
+	ctx := context.Background()
+	if cs.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.timeout)
+		defer cancel()
+	}
+	allowed, err := cs.store.LookupOrigin(ctx, origin)
+
+	cs.mu.Lock()
+	delete(cs.lookups, origin)
+	if err == nil {
+		ttl := cs.ttl
+		if !allowed {
+			ttl = cs.negativeTTL
+		}
+		if ttl > 0 {
+			if len(cs.entries) >= cs.maxEntries {
+				cs.evict()
+			}
+			cs.entries[origin] = cachedOrigin{allowed: allowed, expires: time.Now().Add(ttl)}
+		}
+	}
+	cs.mu.Unlock()
+
+	lookup.allowed, lookup.err = allowed, err
+	close(lookup.done)
+}
+
+// evict removes all of the expired entries from the cache. If the cache is still full
+// after that, it will remove entries until there is space for at least one more.
+func (cs *CachedOriginStore) evict() {
+	now := time.Now()
+	for origin, entry := range cs.entries {
+		if !now.Before(entry.expires) {
+			delete(cs.entries, origin)
+		}
+	}
+	for origin := range cs.entries {
+		if len(cs.entries) < cs.maxEntries {
+			break
+		}
+		delete(cs.entries, origin)
+	}
+}
+
+// Purge removes all of the cached results.
+func (cs *CachedOriginStore) Purge() {
+	cs.mu.Lock()
+	cs.entries = map[string]cachedOrigin{}
+	cs.mu.Unlock()
+}
+
+// MemoryOriginStore is a simple, in-memory OriginStore. It is safe for concurrent use.
+type MemoryOriginStore struct {
+	mu      sync.RWMutex
+	origins map[string]struct{}
+}
+
+// NewMemoryOriginStore creates a new MemoryOriginStore containing the origins. If any of
+// the origins are not valid, an error will be returned.
+func NewMemoryOriginStore(origins ...string) (*MemoryOriginStore, error) {
+	ms := &MemoryOriginStore{origins: map[string]struct{}{}}
+	if err := ms.Add(origins...); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
+
+// Add adds the origins to the store. If any of the origins are not valid, an error will
+// be returned and none of the origins will be added.
+func (ms *MemoryOriginStore) Add(origins ...string) error {
+	normalized := make([]string, 0, len(origins))
+	for _, value := range origins {
+		origin, err := ParseOrigin(value)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, origin.String())
+	}
+	ms.mu.Lock()
+	for _, origin := range normalized {
+		ms.origins[origin] = struct{}{}
+	}
+	ms.mu.Unlock()
+	return nil
+}
+
+// Remove removes the origins from the store.
+func (ms *MemoryOriginStore) Remove(origins ...string) {
+	ms.mu.Lock()
+	for _, value := range origins {
+		if origin, err := ParseOrigin(value); err == nil {
+			delete(ms.origins, origin.String())
+		}
+	}
+	ms.mu.Unlock()
+}
+
+// LookupOrigin implements the OriginStore interface.
+func (ms *MemoryOriginStore) LookupOrigin(ctx context.Context, origin string) (bool, error) {
+	ms.mu.RLock()
+	_, ok := ms.origins[origin]
+	ms.mu.RUnlock()
+	return ok, nil
+}
@@ -0,0 +1,179 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"context"
+	"errors"
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowStore is a fake OriginStore that takes delay to respond and counts the number of
+// lookups that were made.
+type slowStore struct {
+	delay   time.Duration
+	allowed map[string]bool
+	err     error
+	calls   int32
+}
+
+func (ss *slowStore) LookupOrigin(ctx context.Context, origin string) (bool, error) {
+	atomic.AddInt32(&ss.calls, 1)
+	select {
+	case <-time.After(ss.delay):
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+	if ss.err != nil {
+		return false, ss.err
+	}
+	return ss.allowed[origin], nil
+}
+
+func (ss *slowStore) callCount() int {
+	return int(atomic.LoadInt32(&ss.calls))
+}
+
+func TestOriginStoreCoalescesLookups(t *testing.T) {
+	store := &slowStore{
+		delay:   50 * time.Millisecond,
+		allowed: map[string]bool{"https://acme.com": true},
+	}
+	c, err := (&cors.Options{OriginStore: store}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	var failures int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := buildActualRequest(http.MethodGet, "https://acme.com")
+			if c.ApplyActualResponseHeaders(httptest.NewRecorder(), req) != nil {
+				atomic.AddInt32(&failures, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if failures > 0 {
+		t.Errorf("expected all requests to be allowed but %d failed", failures)
+	}
+	if store.callCount() != 1 {
+		t.Errorf("expected 1 store lookup but got %d", store.callCount())
+	}
+
+	// a subsequent request should be served from the cache
+	req := buildActualRequest(http.MethodGet, "https://acme.com")
+	if c.ApplyActualResponseHeaders(httptest.NewRecorder(), req) != nil {
+		t.Error("expected the cached origin to be allowed")
+	}
+	if store.callCount() != 1 {
+		t.Errorf("expected the result to be cached but got %d lookups", store.callCount())
+	}
+}
+
+func TestOriginStoreNegativeCaching(t *testing.T) {
+	store := &slowStore{allowed: map[string]bool{}}
+	c, err := (&cors.Options{
+		OriginStore:                 store,
+		OriginStoreNegativeCacheTTL: 20 * time.Millisecond,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	for i := 0; i < 3; i++ {
+		err := c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://evil.com"))
+		if err == nil || err.Code != cors.RequestErrOriginNotAllowed {
+			t.Error("expected error code to indicate the origin wasn't allowed")
+		}
+	}
+	if store.callCount() != 1 {
+		t.Errorf("expected the negative result to be cached but got %d lookups", store.callCount())
+	}
+	time.Sleep(30 * time.Millisecond)
+	_ = c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://evil.com"))
+	if store.callCount() != 2 {
+		t.Errorf("expected the negative result to expire but got %d lookups", store.callCount())
+	}
+}
+
+func TestOriginStoreFailClosed(t *testing.T) {
+	errDatabase := errors.New("database is down")
+	store := &slowStore{err: errDatabase}
+	c, err := (&cors.Options{OriginStore: store}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	verr := c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://acme.com"))
+	if verr == nil || verr.Code != cors.OriginLookupFailed || !errors.Is(verr.OriginalError, errDatabase) {
+		t.Error("expected the store error to fail the request")
+	}
+	_ = c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://acme.com"))
+	if store.callCount() != 2 {
+		t.Error("expected store errors to not be cached")
+	}
+}
+
+func TestOriginStoreTimeoutFailOpen(t *testing.T) {
+	store := &slowStore{delay: time.Second}
+	c, err := (&cors.Options{
+		OriginStore:         store,
+		OriginStoreTimeout:  10 * time.Millisecond,
+		OriginStoreFailOpen: true,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	start := time.Now()
+	verr := c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://acme.com"))
+	if verr != nil {
+		t.Error("expected the store timeout to fail open")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("expected the store lookup to time out")
+	}
+}
+
+func TestMemoryOriginStore(t *testing.T) {
+	store, err := cors.NewMemoryOriginStore("https://ACME.com:443")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	o := cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		OriginStore:    store,
+	}
+	c, err := o.NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, origin := range []string{"https://theyakka.com", "https://acme.com"} {
+		if c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, origin)) != nil {
+			t.Errorf("expected %q to be allowed", origin)
+		}
+	}
+	if _, err := cors.NewMemoryOriginStore("not an origin"); err == nil {
+		t.Error("expected an invalid origin to be rejected")
+	}
+}
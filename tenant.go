@@ -0,0 +1,303 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HeaderKeyForwarded is the standard (RFC 7239) header used by proxies to pass along the
+// original request details.
+const HeaderKeyForwarded = "Forwarded"
+
+// HeaderKeyXForwardedHost is the de-facto standard header used by proxies to pass along the
+// original Host.
+const HeaderKeyXForwardedHost = "X-Forwarded-Host"
+
+// tenantContextKey is the context key used to store the selected tenant ID.
+type tenantContextKey struct{}
+
+// TenantSelector chooses a policy based on the host that the request was sent to. This
+// allows a single server to serve many tenants (each on their own hostname) with their own
+// CORS rules. Host patterns can either be exact hostnames (e.g. api.acme.com) or use the
+// same glob syntax as wildcard origins (e.g. *.acme.com). Exact hosts always win over
+// patterns, and longer patterns win over shorter ones.
+//
+// By default only the Host of the request is used. If your server sits behind a proxy,
+// use TrustProxies so that the Forwarded / X-Forwarded-Host headers are used for requests
+// that come from the proxy.
+//
+// The selected tenant ID is added to the request context and can be retrieved (e.g. in a
+// PreflightHandlerFunc or the next handler) using TenantFromRequest. TenantSelector is safe
+// for concurrent use.
+type TenantSelector struct {
+	fallback       Policy
+	mu             sync.RWMutex
+	exact          map[string]*tenantEntry
+	patterns       []*tenantEntry
+	trustedProxies []*net.IPNet
+}
+
+// tenantEntry is a tenant registered with a TenantSelector.
+type tenantEntry struct {
+	id      string
+	pattern string
+	policy  Policy
+}
+
+// NewTenantSelector creates a new TenantSelector. fallback is used whenever the host does
+// not match any tenant. It can be nil, in which case requests that don't match will fail
+// validation with the PolicyNotFound code (or be passed straight through by Handler).
+func NewTenantSelector(fallback Policy) *TenantSelector {
+	return &TenantSelector{
+		fallback: fallback,
+		exact:    map[string]*tenantEntry{},
+	}
+}
+
+// Add registers the policy for the tenant. The host pattern is matched against the request
+// host (without the port). An error will be returned if the pattern is invalid or it has
+// already been registered.
+func (ts *TenantSelector) Add(tenantID string, hostPattern string, policy Policy) error {
+	pattern := normalizeRequestHost(hostPattern)
+	if pattern == "" || strings.Contains(pattern, "/") {
+		return &ValidationError{
+			Code:          ConfigurationInvalid,
+			Message:       "the tenant host pattern " + hostPattern + " is invalid",
+			OriginalError: errors.New("host patterns must be a hostname or a hostname glob"),
+		}
+	}
+	entry := &tenantEntry{id: tenantID, pattern: pattern, policy: policy}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if _, exists := ts.exact[pattern]; exists {
+		return ts.duplicateError(hostPattern)
+	}
+	for _, existing := range ts.patterns {
+		if existing.pattern == pattern {
+			return ts.duplicateError(hostPattern)
+		}
+	}
+	if !strings.Contains(pattern, "*") {
+		ts.exact[pattern] = entry
+		return nil
+	}
+	ts.patterns = append(ts.patterns, entry)
+	return nil
+}
+
+// duplicateError returns the error for a host pattern that has already been registered.
+func (ts *TenantSelector) duplicateError(hostPattern string) error {
+	return &ValidationError{
+		Code:    ConfigurationInvalid,
+		Message: "the tenant host pattern " + hostPattern + " has already been registered",
+	}
+}
+
+// TrustProxies sets the proxies (IP addresses or CIDR ranges) that are allowed to set the
+// Forwarded and X-Forwarded-Host headers. Requests from any other address will always use
+// the Host of the request. Only the last element of each header (the one appended by the
+// trusted proxy) is used, so a trusted proxy must always set (or append to) the header it
+// uses.
+func (ts *TenantSelector) TrustProxies(proxies ...string) error {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return &ValidationError{
+				Code:          ConfigurationInvalid,
+				Message:       "the trusted proxy " + proxy + " is invalid",
+				OriginalError: err,
+			}
+		}
+		networks = append(networks, network)
+	}
+	ts.mu.Lock()
+	ts.trustedProxies = networks
+	ts.mu.Unlock()
+	return nil
+}
+
+// Lookup returns the policy that will be used for the request along with the ID of the
+// tenant. If the fallback policy is used, the tenant ID will be empty. If there is no
+// matching policy, the policy will be nil.
+func (ts *TenantSelector) Lookup(r *http.Request) (Policy, string) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	host := normalizeRequestHost(ts.requestHost(r))
+	if entry, ok := ts.exact[host]; ok {
+		return entry.policy, entry.id
+	}
+	var best *tenantEntry
+	for _, entry := range ts.patterns {
+		if globMatch(entry.pattern, host) && (best == nil || len(entry.pattern) > len(best.pattern)) {
+			best = entry
+		}
+	}
+	if best == nil {
+		return ts.fallback, ""
+	}
+	return best.policy, best.id
+}
+
+// requestHost returns the host the request was sent to, taking trusted proxy headers into
+// account.
+func (ts *TenantSelector) requestHost(r *http.Request) string {
+	if !ts.isTrustedProxy(r.RemoteAddr) {
+		return r.Host
+	}
+	// proxies append to these headers, so only the last element was set by the trusted proxy.
+	// Everything before it came from the client (or an untrusted hop) and could be spoofed.
+	if forwarded := lastHeaderElement(r.Header, HeaderKeyForwarded); forwarded != "" {
+		if host := forwardedHost(forwarded); host != "" {
+			return host
+		}
+	}
+	if forwardedHost := lastHeaderElement(r.Header, HeaderKeyXForwardedHost); forwardedHost != "" {
+		return forwardedHost
+	}
+	return r.Host
+}
+
+// isTrustedProxy returns true if the remote address belongs to a trusted proxy.
+func (ts *TenantSelector) isTrustedProxy(remoteAddr string) bool {
+	if len(ts.trustedProxies) == 0 {
+		return false
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	ip := net.ParseIP(remoteAddr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range ts.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePreflight executes ValidatePreflight using the tenant's policy.
+func (ts *TenantSelector) ValidatePreflight(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	c, r := ts.policyFor(r)
+	if c == nil {
+		handler(w, r, preflightError(PolicyNotFound))
+		return
+	}
+	c.ValidatePreflight(w, r, handler)
+}
+
+// ValidateRequest executes ValidateRequest using the tenant's policy.
+func (ts *TenantSelector) ValidateRequest(w http.ResponseWriter, r *http.Request, handler PreflightHandlerFunc) {
+	c, r := ts.policyFor(r)
+	if c == nil {
+		handler(w, r, preflightError(PolicyNotFound))
+		return
+	}
+	c.ValidateRequest(w, r, handler)
+}
+
+// ApplyActualResponseHeaders executes ApplyActualResponseHeaders using the tenant's policy.
+func (ts *TenantSelector) ApplyActualResponseHeaders(w http.ResponseWriter, r *http.Request) *ValidationError {
+	if c, r := ts.policyFor(r); c != nil {
+		return c.ApplyActualResponseHeaders(w, r)
+	}
+	return preflightError(PolicyNotFound)
+}
+
+// Handler is the same as CORS.Handler except that it uses the tenant's policy for each
+// request. Requests that don't match any tenant (and have no fallback) are passed straight
+// through to next.
+func (ts *TenantSelector) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, r := ts.policyFor(r)
+		if c == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		c.serveHTTP(w, r, next)
+	})
+}
+
+// HandlerFunc is the same as Handler, but for http.HandlerFunc values.
+func (ts *TenantSelector) HandlerFunc(next http.HandlerFunc) http.HandlerFunc {
+	return ts.Handler(next).ServeHTTP
+}
+
+// policyFor implements the Policy interface. The returned request is a copy of the request
+// that has the tenant ID attached to its context.
+func (ts *TenantSelector) policyFor(r *http.Request) (*CORS, *http.Request) {
+	policy, tenantID := ts.Lookup(r)
+	if tenantID != "" {
+		r = r.WithContext(context.WithValue(r.Context(), tenantContextKey{}, tenantID))
+	}
+	if policy == nil {
+		return nil, r
+	}
+	return policy.policyFor(r)
+}
+
+// TenantFromRequest returns the ID of the tenant that was selected by a TenantSelector for
+// the request. If no tenant was selected, an empty string will be returned.
+func TenantFromRequest(r *http.Request) string {
+	return TenantFromContext(r.Context())
+}
+
+// TenantFromContext is the same as TenantFromRequest but for a request context.
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenantID
+}
+
+// lastHeaderElement returns the last (comma separated) element of the header. Only the
+// last line of the header is used if it has been sent more than once.
+func lastHeaderElement(header http.Header, key string) string {
+	values := header[key]
+	if len(values) == 0 {
+		return ""
+	}
+	value := values[len(values)-1]
+	if i := strings.LastIndexByte(value, ','); i >= 0 {
+		value = value[i+1:]
+	}
+	return strings.TrimSpace(value)
+}
+
+// forwardedHost returns the host value from a single Forwarded element.
+func forwardedHost(forwarded string) string {
+	for _, pair := range strings.Split(forwarded, ";") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) > 5 && strings.EqualFold(pair[:5], "host=") {
+			return strings.Trim(pair[5:], "\"")
+		}
+	}
+	return ""
+}
+
+// normalizeRequestHost lowercases the host and removes the port and any trailing dot.
+func normalizeRequestHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimPrefix(strings.TrimSuffix(host, "]"), "[")
+	return strings.TrimSuffix(host, ".")
+}
@@ -0,0 +1,142 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTenantSelectorLookup(t *testing.T) {
+	ts := cors.NewTenantSelector(mustCORS(t, "https://public.com"))
+	_ = ts.Add("acme", "api.acme.com", mustCORS(t, "https://acme.com"))
+	_ = ts.Add("wildcard", "*.tenants.theyakka.com", mustCORS(t, "https://theyakka.com"))
+	_ = ts.Add("special", "*.eu.tenants.theyakka.com", mustCORS(t, "https://theyakka.eu"))
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"api.acme.com", "acme"},
+		{"API.ACME.COM:8443", "acme"},
+		{"api.acme.com.", "acme"},
+		{"one.tenants.theyakka.com", "wildcard"},
+		{"one.eu.tenants.theyakka.com", "special"},
+		{"tenants.theyakka.com", ""},
+		{"other.com", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = test.host
+		if _, tenantID := ts.Lookup(r); tenantID != test.expected {
+			t.Errorf("%s: expected '%s' but got '%s'", test.host, test.expected, tenantID)
+		}
+	}
+	if err := ts.Add("duplicate", "API.acme.com", mustCORS(t, "https://acme.com")); err == nil {
+		t.Error("expected duplicate hosts to be rejected")
+	}
+}
+
+func TestTenantSelectorForwardedHeaders(t *testing.T) {
+	ts := cors.NewTenantSelector(nil)
+	_ = ts.Add("acme", "api.acme.com", mustCORS(t, "https://acme.com"))
+	if err := ts.TrustProxies("10.0.0.0/8", "192.168.1.1"); err != nil {
+		t.Error(err)
+		return
+	}
+	tests := []struct {
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+	}{
+		{"10.1.2.3:1234", cors.HeaderKeyXForwardedHost, "api.acme.com", "acme"},
+		{"10.1.2.3:1234", cors.HeaderKeyXForwardedHost, "client.example, api.acme.com", "acme"},
+		{"192.168.1.1:1234", cors.HeaderKeyForwarded, `for=1.2.3.4;host="api.acme.com";proto=https`, "acme"},
+		// the client supplied elements are ignored, only the last one was set by the proxy
+		{"10.1.2.3:1234", cors.HeaderKeyXForwardedHost, "api.acme.com, proxy.internal", ""},
+		{"192.168.1.1:1234", cors.HeaderKeyForwarded, "host=api.acme.com, for=1.2.3.4;host=internal.local", ""},
+		{"8.8.8.8:1234", cors.HeaderKeyXForwardedHost, "api.acme.com", ""},
+		{"8.8.8.8:1234", cors.HeaderKeyForwarded, "host=api.acme.com", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Host = "internal.local"
+		r.RemoteAddr = test.remoteAddr
+		r.Header.Set(test.header, test.value)
+		if _, tenantID := ts.Lookup(r); tenantID != test.expected {
+			t.Errorf("%s: expected '%s' but got '%s'", test.remoteAddr, test.expected, tenantID)
+		}
+	}
+	if err := ts.TrustProxies("not-an-ip"); err == nil {
+		t.Error("expected the invalid proxy to be rejected")
+	}
+}
+
+func TestTenantSelectorValidation(t *testing.T) {
+	ts := cors.NewTenantSelector(nil)
+	_ = ts.Add("acme", "api.acme.com", mustCORS(t, "https://acme.com"))
+
+	r := buildActualRequest(http.MethodGet, "https://acme.com")
+	r.Host = "api.acme.com"
+	ts.ValidateRequest(httptest.NewRecorder(), r, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error != nil {
+			t.Error(error)
+		}
+		if cors.TenantFromRequest(r) != "acme" {
+			t.Error("expected the tenant to be available from the request")
+		}
+	})
+
+	r.Host = "api.other.com"
+	ts.ValidateRequest(httptest.NewRecorder(), r, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {
+		if error == nil || error.Code != cors.PolicyNotFound {
+			t.Error("expected the request to fail because there is no tenant")
+		}
+		if cors.TenantFromRequest(r) != "" {
+			t.Error("expected no tenant")
+		}
+	})
+
+	var tenantID string
+	handler := ts.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID = cors.TenantFromRequest(r)
+	}))
+	r.Host = "api.acme.com"
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if tenantID != "acme" || w.Header().Get(cors.HeaderKeyAccCtlResAllowOrigin) != "https://acme.com" {
+		t.Error("expected the handler to use the tenant's policy")
+	}
+}
+
+func TestTenantSelectorDecisions(t *testing.T) {
+	metrics := &recordingMetrics{}
+	c, err := (&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://acme.com")},
+		Metrics:        metrics,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ts := cors.NewTenantSelector(nil)
+	_ = ts.Add("acme", "api.acme.com", c)
+	// the tenant should still be reported when the selector is nested in a PolicySet
+	ps := cors.NewPolicySet(ts)
+
+	r := buildActualRequest(http.MethodGet, "https://acme.com")
+	r.Host = "api.acme.com"
+	_ = ps.ApplyActualResponseHeaders(httptest.NewRecorder(), r)
+	r = buildPreflightRequest("https://acme.com")
+	r.Host = "api.acme.com"
+	ps.ValidatePreflight(httptest.NewRecorder(), r, func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {})
+	if len(metrics.decisions) != 2 || metrics.decisions[0].Tenant != "acme" || metrics.decisions[1].Tenant != "acme" {
+		t.Errorf("expected the tenant to be in the decisions: %+v", metrics.decisions)
+	}
+}
@@ -0,0 +1,193 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The names of the spans started by the CORS instance.
+const (
+	// SpanPreflight is the span around the whole preflight validation.
+	SpanPreflight = "cors.preflight"
+	// SpanActual is the span around the whole actual request validation.
+	SpanActual = "cors.actual"
+	// SpanOriginMatch is the span around matching the origin against AllowedOrigins.
+	SpanOriginMatch = "cors.origin_match"
+	// SpanAllowOriginFunc is the span around the call to the AllowOriginFunc.
+	SpanAllowOriginFunc = "cors.allow_origin_func"
+	// SpanOriginStore is the span around the OriginStore lookup.
+	SpanOriginStore = "cors.origin_store"
+	// SpanHeaderValidation is the span around validating the requested headers.
+	SpanHeaderValidation = "cors.header_validation"
+)
+
+// Tracer is the interface that wraps span creation. If Options.Tracer is set, the CORS
+// instance will start spans around the validation of each request, origin matching,
+// dynamic origin lookups and header validation. It allows you to connect the library to
+// your tracing stack without the library depending on it.
+type Tracer interface {
+	// StartSpan starts a new span as a child of the span in ctx (if any). The returned
+	// context contains the new span. The context passed to the AllowOriginFunc and the
+	// OriginStore will contain the dynamic lookup span.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single, timed operation started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute on the span. Values will be strings, bools or ints.
+	SetAttribute(key string, value interface{})
+	// End completes the span.
+	End()
+}
+
+// NoopTracer is a Tracer that does nothing. It is the default Tracer and when it is used
+// no spans will be started at all.
+type NoopTracer struct{}
+
+// StartSpan implements the Tracer interface.
+func (NoopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// noopSpan is the Span returned by NoopTracer.
+type noopSpan struct{}
+
+// SetAttribute implements the Span interface.
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+// End implements the Span interface.
+func (noopSpan) End() {}
+
+// startSpan starts a span using the Tracer in the attached Options. If tracing is disabled,
+// the context will be returned as is and the span will be nil.
+func (c *CORS) startSpan(ctx context.Context, name string) (context.Context, Span) {
+	if c.tracer == nil {
+		return ctx, nil
+	}
+	return c.tracer.StartSpan(ctx, name)
+}
+
+// endDecisionSpan sets the decision attributes on the span for the whole request and then
+// ends it.
+func (c *CORS) endDecisionSpan(span Span, r *http.Request, err *ValidationError, cached bool) {
+	span.SetAttribute("origin", r.Header.Get(HeaderKeyReqOrigin))
+	span.SetAttribute("allowed", err == nil)
+	if err != nil {
+		span.SetAttribute("code", int(err.Code))
+	}
+	if c.options.Name != "" {
+		span.SetAttribute("policy", c.options.Name)
+	}
+	if tenantID := TenantFromRequest(r); tenantID != "" {
+		span.SetAttribute("tenant", tenantID)
+	}
+	span.SetAttribute("cached", cached)
+	span.End()
+}
+
+// endLookupSpan sets the result attributes on a dynamic lookup span and then ends it.
+func endLookupSpan(span Span, allowed bool, err error) {
+	span.SetAttribute("allowed", allowed)
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+	}
+	span.End()
+}
+
+// TraceRecorder is an in-memory Tracer that records every span. It is intended for tests.
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span recorded by a TraceRecorder.
+type RecordedSpan struct {
+	// ID is the (1-based) order that the span was started in.
+	ID int
+	// ParentID is the ID of the span that this span was started under. It will be 0 if the
+	// span has no parent.
+	ParentID int
+	// Name is the name of the span.
+	Name string
+	// Attributes contains the attributes that were set on the span.
+	Attributes map[string]interface{}
+	// Start is when the span was started.
+	Start time.Time
+	// End is when the span ended. It will be the zero time if the span hasn't ended.
+	End time.Time
+}
+
+// recordedSpanKey is the context key for the ID of the current RecordedSpan.
+type recordedSpanKey struct{}
+
+// NewTraceRecorder creates a new, empty TraceRecorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+// StartSpan implements the Tracer interface.
+func (tr *TraceRecorder) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	parentID, _ := ctx.Value(recordedSpanKey{}).(int)
+	span := &RecordedSpan{
+		ParentID:   parentID,
+		Name:       name,
+		Attributes: map[string]interface{}{},
+		Start:      time.Now(),
+	}
+	tr.mu.Lock()
+	tr.spans = append(tr.spans, span)
+	span.ID = len(tr.spans)
+	tr.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span.ID), &recordedSpan{recorder: tr, span: span}
+}
+
+// Spans returns a copy of all of the recorded spans in the order they were started.
+func (tr *TraceRecorder) Spans() []RecordedSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	spans := make([]RecordedSpan, 0, len(tr.spans))
+	for _, span := range tr.spans {
+		copied := *span
+		copied.Attributes = make(map[string]interface{}, len(span.Attributes))
+		for key, value := range span.Attributes {
+			copied.Attributes[key] = value
+		}
+		spans = append(spans, copied)
+	}
+	return spans
+}
+
+// Reset removes all of the recorded spans.
+func (tr *TraceRecorder) Reset() {
+	tr.mu.Lock()
+	tr.spans = nil
+	tr.mu.Unlock()
+}
+
+// recordedSpan is the Span returned by TraceRecorder.
+type recordedSpan struct {
+	recorder *TraceRecorder
+	span     *RecordedSpan
+}
+
+// SetAttribute implements the Span interface.
+func (rs *recordedSpan) SetAttribute(key string, value interface{}) {
+	rs.recorder.mu.Lock()
+	rs.span.Attributes[key] = value
+	rs.recorder.mu.Unlock()
+}
+
+// End implements the Span interface.
+func (rs *recordedSpan) End() {
+	rs.recorder.mu.Lock()
+	rs.span.End = time.Now()
+	rs.recorder.mu.Unlock()
+}
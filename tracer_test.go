@@ -0,0 +1,106 @@
+// Created by Yakka (https://theyakka.com)
+//
+// Copyright (c) 2020 Yakka LLC.
+// All rights reserved.
+// See the LICENSE file for licensing details and requirements.
+
+package cors_test
+
+import (
+	"context"
+	"github.com/theyakka/cors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracerSpans(t *testing.T) {
+	tracer := cors.NewTraceRecorder()
+	store, _ := cors.NewMemoryOriginStore("https://store.theyakka.com")
+	var lookupCtx context.Context
+	c, err := (&cors.Options{
+		Name:           "api",
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		AllowOriginFunc: func(ctx context.Context, r *http.Request, origin string) (bool, error) {
+			lookupCtx = ctx
+			return false, nil
+		},
+		OriginStore:    store,
+		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		Tracer:         tracer,
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	c.ValidatePreflight(httptest.NewRecorder(), buildPreflightRequest("https://store.theyakka.com"), handler)
+
+	spans := tracer.Spans()
+	expected := []struct {
+		name     string
+		parentID int
+	}{
+		{cors.SpanPreflight, 0},
+		{cors.SpanOriginMatch, 1},
+		{cors.SpanAllowOriginFunc, 1},
+		{cors.SpanOriginStore, 1},
+		{cors.SpanHeaderValidation, 1},
+	}
+	if len(spans) != len(expected) {
+		t.Errorf("expected %d spans but got %d: %+v", len(expected), len(spans), spans)
+		return
+	}
+	for i, span := range spans {
+		if span.Name != expected[i].name || span.ParentID != expected[i].parentID {
+			t.Errorf("span %d: expected %s (parent %d) but got %s (parent %d)", i, expected[i].name,
+				expected[i].parentID, span.Name, span.ParentID)
+		}
+		if span.End.IsZero() {
+			t.Errorf("span %d: expected the span to have ended", i)
+		}
+	}
+	if spans[0].Attributes["allowed"] != true || spans[0].Attributes["policy"] != "api" ||
+		spans[0].Attributes["origin"] != "https://store.theyakka.com" {
+		t.Errorf("unexpected preflight attributes: %v", spans[0].Attributes)
+	}
+	if spans[1].Attributes["matched"] != false || spans[2].Attributes["allowed"] != false ||
+		spans[3].Attributes["allowed"] != true || spans[4].Attributes["headers"] != "Authorization, Content-Type" {
+		t.Errorf("unexpected child attributes: %+v", spans[1:])
+	}
+	// spans started by the AllowOriginFunc should be children of the lookup span
+	_, child := tracer.StartSpan(lookupCtx, "child")
+	child.End()
+	if spans = tracer.Spans(); spans[len(spans)-1].ParentID != 3 {
+		t.Error("expected the lookup span context to be passed to the AllowOriginFunc")
+	}
+
+	tracer.Reset()
+	_ = c.ApplyActualResponseHeaders(httptest.NewRecorder(), buildActualRequest(http.MethodGet, "https://theyakka.com"))
+	spans = tracer.Spans()
+	if len(spans) != 2 || spans[0].Name != cors.SpanActual || spans[1].Name != cors.SpanOriginMatch ||
+		spans[1].Attributes["rule"] != "exact:https://theyakka.com" {
+		t.Errorf("unexpected actual request spans: %+v", spans)
+	}
+}
+
+func TestNoopTracer(t *testing.T) {
+	c, err := (&cors.Options{
+		AllowedOrigins: []cors.OriginMatcher{cors.EM("https://theyakka.com")},
+		AllowedHeaders: cors.DefaultHeadersWith("Authorization"),
+		Tracer:         cors.NoopTracer{},
+	}).NewCORS()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	handler := func(w http.ResponseWriter, r *http.Request, error *cors.ValidationError) {}
+	req := buildPreflightRequest("https://theyakka.com")
+	w := httptest.NewRecorder()
+	allocs := testing.AllocsPerRun(100, func() {
+		c.ValidatePreflight(w, req, handler)
+	})
+	if allocs != 0 {
+		t.Errorf("expected 0 allocations but got %v", allocs)
+	}
+}